@@ -0,0 +1,293 @@
+// Package analysis statically flags code likely to leak goroutines, ahead
+// of the checks goleaker runs at test time:
+//
+//   - go statements running a function literal that blocks sending on a
+//     captured unbuffered channel, with no select offering a way out
+//   - go statements running a function literal that captures a
+//     context.Context it never observes, while it loops forever or blocks
+//     on a channel
+//   - test functions starting goroutines without a goleaker check
+//
+// Run analyzes a type-checked package; Main runs it as a go vet tool, see
+// cmd/goleakvet.
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// ModulePath is the import path prefix of the packages whose calls count
+// as a goleaker check.
+const ModulePath = "github.com/rfyiamcool/goleaker"
+
+// Diagnostic is a finding at a position of the analyzed package.
+type Diagnostic struct {
+	Pos     token.Pos
+	Message string
+}
+
+// Run analyzes the files of a type-checked package. info needs its Defs,
+// Uses and Types maps filled in. Diagnostics are ordered by position.
+func Run(fset *token.FileSet, files []*ast.File, info *types.Info) []Diagnostic {
+	var diags []Diagnostic
+	report := func(pos token.Pos, msg string) {
+		diags = append(diags, Diagnostic{Pos: pos, Message: msg})
+	}
+	checkedMain := false
+	for _, f := range files {
+		if isTestFile(fset, f) && testMainChecks(f, info) {
+			checkedMain = true
+		}
+	}
+	for _, f := range files {
+		test := isTestFile(fset, f)
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				if g, ok := n.(*ast.GoStmt); ok {
+					if lit, ok := g.Call.Fun.(*ast.FuncLit); ok {
+						checkGoLit(fn.Body, lit, info, report)
+					}
+				}
+				return true
+			})
+			if test && !checkedMain && isTestFunc(fn, info) && startsGoroutines(fn.Body) && !callsGoleaker(fn.Body, info) {
+				report(fn.Name.Pos(), fn.Name.Name+" starts goroutines without a goleaker check, add defer goleaker.Check(t)()")
+			}
+		}
+	}
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Pos < diags[j].Pos })
+	return diags
+}
+
+// checkGoLit reports the blocking operations of a function literal run by
+// a go statement in the function body encl that have no cancellation path.
+func checkGoLit(encl *ast.BlockStmt, lit *ast.FuncLit, info *types.Info, report func(token.Pos, string)) {
+	captured := func(e ast.Expr) *types.Var {
+		id, ok := ast.Unparen(e).(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		v, ok := info.Uses[id].(*types.Var)
+		if !ok || v.Pos() >= lit.Pos() && v.Pos() < lit.End() || v.Parent() == nil || v.Parent() == v.Pkg().Scope() {
+			return nil
+		}
+		return v
+	}
+
+	var (
+		blocks   bool
+		loops    bool
+		observed = map[*types.Var]bool{}
+		contexts []*types.Var
+		seen     = map[*types.Var]bool{}
+	)
+	var walk func(n ast.Node, inSelect bool)
+	walk = func(n ast.Node, inSelect bool) {
+		ast.Inspect(n, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				// nested literals run on their own
+				return false
+			case *ast.SelectStmt:
+				multi := len(n.Body.List) > 1
+				for _, stmt := range n.Body.List {
+					cc := stmt.(*ast.CommClause)
+					if cc.Comm == nil {
+						multi = true
+					}
+				}
+				if !multi {
+					blocks = true
+				}
+				for _, stmt := range n.Body.List {
+					cc := stmt.(*ast.CommClause)
+					if cc.Comm != nil {
+						walk(cc.Comm, multi)
+					}
+					for _, s := range cc.Body {
+						walk(s, false)
+					}
+				}
+				return false
+			case *ast.ForStmt:
+				if n.Cond == nil {
+					loops = true
+				}
+			case *ast.RangeStmt:
+				if isChan(info.TypeOf(n.X)) {
+					blocks = true
+				}
+			case *ast.SendStmt:
+				if inSelect {
+					break
+				}
+				blocks = true
+				if v := captured(n.Chan); v != nil && isChan(v.Type()) && !buffered(encl, v, info) {
+					report(n.Arrow, "goroutine blocks sending on captured channel "+v.Name()+
+						" with no cancellation path, select on ctx.Done() as well or buffer the channel")
+				}
+			case *ast.UnaryExpr:
+				if n.Op == token.ARROW && !inSelect {
+					blocks = true
+				}
+			case *ast.CallExpr:
+				if sel, ok := n.Fun.(*ast.SelectorExpr); ok && (sel.Sel.Name == "Done" || sel.Sel.Name == "Err") {
+					if v := captured(sel.X); v != nil {
+						observed[v] = true
+					}
+				}
+				for _, arg := range n.Args {
+					if v := captured(arg); v != nil {
+						observed[v] = true
+					}
+				}
+			case *ast.Ident:
+				if v := captured(n); v != nil && isContext(v.Type()) && !seen[v] {
+					seen[v] = true
+					contexts = append(contexts, v)
+				}
+			}
+			return true
+		})
+	}
+	walk(lit.Body, false)
+	if !blocks && !loops {
+		return
+	}
+	for _, v := range contexts {
+		if !observed[v] {
+			report(lit.Pos(), "goroutine captures "+v.Name()+" but never observes its cancellation, select on "+v.Name()+".Done()")
+		}
+	}
+}
+
+// buffered reports whether v is assigned a buffered channel made in body.
+func buffered(body *ast.BlockStmt, v *types.Var, info *types.Info) bool {
+	found := false
+	check := func(id *ast.Ident, rhs ast.Expr) {
+		if info.Defs[id] != v && info.Uses[id] != v {
+			return
+		}
+		call, ok := ast.Unparen(rhs).(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			return
+		}
+		if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "make" {
+			return
+		}
+		if lit, ok := call.Args[1].(*ast.BasicLit); ok && lit.Value == "0" {
+			return
+		}
+		found = true
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) == len(n.Rhs) {
+				for i, lhs := range n.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						check(id, n.Rhs[i])
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			if len(n.Names) == len(n.Values) {
+				for i, id := range n.Names {
+					check(id, n.Values[i])
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func isChan(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	_, ok := t.Underlying().(*types.Chan)
+	return ok
+}
+
+func isContext(t types.Type) bool {
+	return isNamed(t, "context", "Context")
+}
+
+func isNamed(t types.Type, pkg, name string) bool {
+	n, ok := types.Unalias(t).(*types.Named)
+	return ok && n.Obj().Pkg() != nil && n.Obj().Pkg().Path() == pkg && n.Obj().Name() == name
+}
+
+func isTestFile(fset *token.FileSet, f *ast.File) bool {
+	return strings.HasSuffix(fset.Position(f.Pos()).Filename, "_test.go")
+}
+
+// isTestFunc reports whether fn is a TestXxx(t *testing.T) function.
+func isTestFunc(fn *ast.FuncDecl, info *types.Info) bool {
+	name := fn.Name.Name
+	if fn.Recv != nil || !strings.HasPrefix(name, "Test") || name == "TestMain" || fn.Type.Params.NumFields() != 1 {
+		return false
+	}
+	ptr, ok := info.TypeOf(fn.Type.Params.List[0].Type).(*types.Pointer)
+	return ok && isNamed(ptr.Elem(), "testing", "T")
+}
+
+// testMainChecks reports whether f has a TestMain calling into goleaker,
+// which checks every test of the package.
+func testMainChecks(f *ast.File, info *types.Info) bool {
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "TestMain" && fn.Body != nil {
+			return callsGoleaker(fn.Body, info)
+		}
+	}
+	return false
+}
+
+func startsGoroutines(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if _, ok := n.(*ast.GoStmt); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// callsGoleaker reports whether body calls a function of a goleaker
+// package.
+func callsGoleaker(body *ast.BlockStmt, info *types.Info) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return !found
+		}
+		var id *ast.Ident
+		switch fn := ast.Unparen(call.Fun).(type) {
+		case *ast.Ident:
+			id = fn
+		case *ast.SelectorExpr:
+			id = fn.Sel
+		}
+		if id != nil {
+			if obj := info.Uses[id]; obj != nil && obj.Pkg() != nil {
+				path := obj.Pkg().Path()
+				if path == ModulePath || strings.HasPrefix(path, ModulePath+"/") {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
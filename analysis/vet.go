@@ -0,0 +1,214 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// vetConfig is the package description go vet hands its tool.
+type vetConfig struct {
+	ID                        string
+	ImportPath                string
+	GoFiles                   []string
+	ImportMap                 map[string]string
+	PackageFile               map[string]string
+	Standard                  map[string]bool
+	GoVersion                 string
+	VetxOnly                  bool
+	VetxOutput                string
+	Stdout                    string
+	SucceedOnTypecheckFailure bool
+}
+
+// Main runs the analyzer as a go vet tool, speaking the protocol of
+// go vet -vettool, and exits. Run without a go vet configuration, it runs
+// go vet -vettool on itself with its arguments, so
+//
+//	goleakvet ./...
+//
+// analyzes the packages of the current module.
+func Main() {
+	progname := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	fs := flag.NewFlagSet(progname, flag.ExitOnError)
+	printFlags := fs.Bool("flags", false, "print the flags of the analyzer as JSON")
+	version := fs.String("V", "", "print the version and exit")
+	asJSON := fs.Bool("json", false, "write diagnostics to stdout as JSON")
+	fs.Parse(os.Args[1:])
+	args := fs.Args()
+	switch {
+	case *printFlags:
+		// go vet only forwards the flags listed here, of which the
+		// analyzer has none of its own
+		fmt.Println("[]")
+		os.Exit(0)
+	case *version != "":
+		id, err := buildID()
+		if err != nil {
+			fatalf(progname, "%s", err)
+		}
+		fmt.Printf("%s version devel buildID=%s\n", progname, id)
+		os.Exit(0)
+	case len(args) == 1 && strings.HasSuffix(args[0], ".cfg"):
+		os.Exit(runVet(progname, args[0], *asJSON))
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf(progname, "%s", err)
+	}
+	cmd := exec.Command("go", append([]string{"vet", "-vettool=" + exe}, args...)...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			os.Exit(exit.ExitCode())
+		}
+		fatalf(progname, "%s", err)
+	}
+	os.Exit(0)
+}
+
+// runVet analyzes the package described by the configuration file and
+// returns the exit code: 1 with diagnostics or errors, 0 otherwise. With
+// asJSON, diagnostics are written as JSON to the stdout file of the
+// configuration, which newer go vet decodes, and only errors set the exit
+// code.
+func runVet(progname, file string, asJSON bool) int {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fatalf(progname, "%s", err)
+	}
+	var cfg vetConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fatalf(progname, "cannot decode %s: %s", file, err)
+	}
+	// go vet expects the facts of every package, of which there are none
+	if cfg.VetxOutput != "" {
+		if err := os.WriteFile(cfg.VetxOutput, nil, 0o644); err != nil {
+			fatalf(progname, "%s", err)
+		}
+	}
+	if cfg.VetxOnly || cfg.Standard[cfg.ImportPath] {
+		return 0
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range cfg.GoFiles {
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			if cfg.SucceedOnTypecheckFailure {
+				return 0
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		files = append(files, f)
+	}
+
+	compiled := importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		file, ok := cfg.PackageFile[path]
+		if !ok {
+			return nil, fmt.Errorf("no export data for %q", path)
+		}
+		return os.Open(file)
+	})
+	conf := types.Config{
+		GoVersion: cfg.GoVersion,
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if path == "unsafe" {
+				return types.Unsafe, nil
+			}
+			if mapped, ok := cfg.ImportMap[path]; ok {
+				path = mapped
+			}
+			return compiled.Import(path)
+		}),
+	}
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	if _, err := conf.Check(cfg.ImportPath, fset, files, info); err != nil {
+		if cfg.SucceedOnTypecheckFailure {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	diags := Run(fset, files, info)
+	if asJSON {
+		type jsonDiagnostic struct {
+			Posn    string `json:"posn"`
+			Message string `json:"message"`
+		}
+		out := []jsonDiagnostic{}
+		for _, d := range diags {
+			out = append(out, jsonDiagnostic{Posn: fset.Position(d.Pos).String(), Message: d.Message})
+		}
+		if len(out) == 0 {
+			return 0
+		}
+		b, err := json.Marshal(map[string]map[string][]jsonDiagnostic{cfg.ID: {"goleaker": out}})
+		if err != nil {
+			fatalf(progname, "%s", err)
+		}
+		if cfg.Stdout != "" {
+			err = os.WriteFile(cfg.Stdout, b, 0o644)
+		} else {
+			_, err = os.Stdout.Write(b)
+		}
+		if err != nil {
+			fatalf(progname, "%s", err)
+		}
+		return 0
+	}
+	for _, d := range diags {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fset.Position(d.Pos), d.Message)
+	}
+	if len(diags) > 0 {
+		return 1
+	}
+	return 0
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// buildID identifies the executable for the build cache of go vet, which
+// reruns the tool on unchanged packages when it changes.
+func buildID() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func fatalf(progname, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, progname+": "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,161 @@
+package goleaker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The files of a failure artifact written by WithFailureArtifact. The
+// dumps can be replayed with FileSource(ArtifactBaseline, ArtifactDump).
+const (
+	// ArtifactBaseline holds the goroutines captured when the check began.
+	ArtifactBaseline = "baseline.txt"
+	// ArtifactDump holds the goroutines captured when the check failed.
+	ArtifactDump = "goroutines.txt"
+	// ArtifactLeaks holds the leaked goroutines grouped by signature, as
+	// JSON.
+	ArtifactLeaks = "leaks.json"
+	// ArtifactOptions describes the options of the check, as JSON.
+	ArtifactOptions = "options.json"
+)
+
+// WithFailureArtifact makes a failing check write everything needed to
+// debug it offline into a new timestamped directory under dir: the
+// complete goroutine dumps of the baseline and of the failure, the leaks
+// and the options of the check. See ArtifactBaseline and its siblings.
+func WithFailureArtifact(dir string) Option {
+	return func(o *options) {
+		o.failureArtifact = dir
+	}
+}
+
+type artifactGroup struct {
+	ID         string    `json:"id"`
+	State      string    `json:"state"`
+	Class      LeakClass `json:"class"`
+	Top        string    `json:"top"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	Kind       string    `json:"kind,omitempty"`
+	Goroutines []uint64  `json:"goroutines"`
+	Stack      string    `json:"stack"`
+}
+
+type artifactOptions struct {
+	Test          string        `json:"test,omitempty"`
+	GoVersion     string        `json:"go_version"`
+	Timeout       time.Duration `json:"timeout_ns"`
+	TimeScale     float64       `json:"time_scale"`
+	Ignores       int           `json:"ignores"`
+	Requires      int           `json:"requires"`
+	Only          int           `json:"only"`
+	Suppressions  []string      `json:"suppressions,omitempty"`
+	Warns         int           `json:"warns"`
+	FailAbove     int           `json:"fail_above,omitempty"`
+	SettleChecks  int           `json:"settle_checks,omitempty"`
+	Confirmations int           `json:"confirmations,omitempty"`
+	Strict        bool          `json:"strict,omitempty"`
+	Sampling      bool          `json:"sampling,omitempty"`
+	ConfigFile    string        `json:"config_file,omitempty"`
+	FlakeFile     string        `json:"flake_file,omitempty"`
+	Quarantine    string        `json:"quarantine_file,omitempty"`
+}
+
+// writeFailureArtifact writes the failure artifact of a check that found
+// leaked goroutines, if one was asked for.
+func (o *options) writeFailureArtifact(t ErrorReporter, orig baseline, leaked []*Goroutine) {
+	if o.failureArtifact == "" {
+		return
+	}
+	name := "check"
+	if o.testName != "" {
+		name = strings.NewReplacer("/", "_", " ", "_").Replace(o.testName)
+	}
+	dir := filepath.Join(o.failureArtifact, name+"-"+time.Now().Format("20060102-150405.000"))
+	if err := o.writeArtifactFiles(t, dir, orig, leaked); err != nil {
+		t.Errorf("leaktest: failure artifact: %s", err)
+		return
+	}
+	t.Errorf("leaktest: failure artifact written to %s", dir)
+}
+
+func (o *options) writeArtifactFiles(t ErrorReporter, dir string, orig baseline, leaked []*Goroutine) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	all, _ := captureRaw(t, o)
+	if err := writeDump(filepath.Join(dir, ArtifactBaseline), orig.raw); err != nil {
+		return err
+	}
+	if err := writeDump(filepath.Join(dir, ArtifactDump), all); err != nil {
+		return err
+	}
+
+	var groups []artifactGroup
+	for _, gr := range o.leakGroups(leaked) {
+		ag := artifactGroup{
+			ID:        gr.id,
+			State:     gr.state,
+			Class:     gr.class,
+			Top:       gr.top,
+			CreatedBy: gr.goroutines[0].CreatedBy,
+			Kind:      gr.kind,
+			Stack:     gr.goroutines[0].Stack,
+		}
+		for _, g := range gr.goroutines {
+			ag.Goroutines = append(ag.Goroutines, g.ID)
+		}
+		groups = append(groups, ag)
+	}
+	if err := writeJSON(filepath.Join(dir, ArtifactLeaks), groups); err != nil {
+		return err
+	}
+
+	opts := artifactOptions{
+		Test:          o.testName,
+		GoVersion:     runtime.Version(),
+		Timeout:       o.timeout,
+		TimeScale:     TimeScale,
+		Ignores:       len(o.ignores),
+		Requires:      len(o.requires),
+		Only:          len(o.only),
+		Warns:         len(o.warns),
+		FailAbove:     o.failAbove,
+		SettleChecks:  o.settleChecks,
+		Confirmations: o.confirmations,
+		Strict:        o.strict,
+		Sampling:      o.sampling,
+		ConfigFile:    o.configFile,
+		FlakeFile:     o.flakeFile,
+		Quarantine:    o.quarantineFile,
+	}
+	for _, s := range o.suppressions {
+		opts.Suppressions = append(opts.Suppressions, s.Suppression.String())
+	}
+	return writeJSON(filepath.Join(dir, ArtifactOptions), opts)
+}
+
+// writeDump writes gs in the format of runtime.Stack, which ParseDump
+// reads back.
+func writeDump(path string, gs []Goroutine) error {
+	var b strings.Builder
+	for i, g := range gs {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(strings.TrimRight(g.Stack, "\n"))
+	}
+	b.WriteByte('\n')
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,75 @@
+// Package assert checks for leaked goroutines at any point of a test, for
+// tests preferring explicit assertions to deferring goleaker.Check:
+//
+//	srv.Close()
+//	assert.EventuallyNoLeaks(t, time.Second)
+//
+// Every goroutine running besides the test's own counts, so the
+// assertions do not suit parallel tests.
+package assert
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// helper marks the caller as a test helper if t is a testing.TB.
+func helper(t goleaker.ErrorReporter) {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+}
+
+// NoLeaks reports the goroutines running besides the calling one and
+// those the options ignore, and returns whether there were none. As
+// goleaker.Find, it looks once unless given goleaker.WithTimeout.
+func NoLeaks(t goleaker.ErrorReporter, opts ...goleaker.Option) bool {
+	helper(t)
+	if err := goleaker.Find(opts...); err != nil {
+		t.Errorf("%s", err)
+		return false
+	}
+	return true
+}
+
+// EventuallyNoLeaks is the same as NoLeaks, but waits up to d for the
+// goroutines to exit.
+func EventuallyNoLeaks(t goleaker.ErrorReporter, d time.Duration, opts ...goleaker.Option) bool {
+	helper(t)
+	return NoLeaks(t, append(opts[:len(opts):len(opts)], goleaker.WithTimeout(d))...)
+}
+
+// LeaksMatching reports unless exactly n of the goroutines running besides
+// the calling one match m, and returns whether n did. It pins down known
+// leaks, e.g. of a dependency, so fixing or worsening them shows. It
+// reports through goleaker.Reporter with opts, so that
+// goleaker.WithDryRun applies.
+func LeaksMatching(t goleaker.ErrorReporter, m goleaker.Matcher, n int, opts ...goleaker.Option) bool {
+	helper(t)
+	t = goleaker.Reporter(t, opts...)
+	gs, err := goleaker.RuntimeSource().Capture()
+	if err != nil {
+		t.Errorf("leaktest: %s", err)
+		return false
+	}
+	self := goleaker.CurrentGoroutineID()
+	var matching []*goleaker.Goroutine
+	for _, g := range goleaker.Interesting(gs, goleaker.IgnoreGoroutineIDs(self)) {
+		if m(g) {
+			matching = append(matching, g)
+		}
+	}
+	if len(matching) == n {
+		return true
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "leaktest: want %d goroutine(s) matching, got %d", n, len(matching))
+	for _, g := range matching {
+		b.WriteString("\n" + g.Stack)
+	}
+	t.Errorf("%s", b.String())
+	return false
+}
@@ -0,0 +1,105 @@
+package goleaker
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+type shutdownHook struct {
+	name string
+	stop func()
+}
+
+var shutdownHooks struct {
+	sync.Mutex
+	byPackage map[string][]shutdownHook
+}
+
+// RegisterShutdown declares stop as the function shutting down the
+// background goroutines of the calling package, for AuditPackage to run.
+// stop runs once, by the first AuditPackage to finish; the ones after
+// find whatever it stopped stopped.
+func RegisterShutdown(name string, stop func()) {
+	pkg := callerPackage(2)
+	shutdownHooks.Lock()
+	defer shutdownHooks.Unlock()
+	if shutdownHooks.byPackage == nil {
+		shutdownHooks.byPackage = map[string][]shutdownHook{}
+	}
+	shutdownHooks.byPackage[pkg] = append(shutdownHooks.byPackage[pkg], shutdownHook{name: name, stop: sync.OnceFunc(stop)})
+}
+
+// callerPackage returns the package of the function skip frames up the
+// stack, without the _test suffix of external test packages.
+func callerPackage(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSuffix(funcPackage(runtime.FuncForPC(pc).Name()), "_test")
+}
+
+// AuditPackage is Check for the maintainers of a library, called from the
+// library's own tests. Before checking it runs the shutdown hooks the
+// library declared with RegisterShutdown. Then it also reports every
+// goroutine created by the library and its subpackages that is still
+// running after the grace period of WithTimeout, even one started before
+// the check, enforcing that whatever the library starts can be stopped.
+func AuditPackage(t ErrorReporter, opts ...Option) func() {
+	pkg := callerPackage(2)
+	reported := map[uint64]bool{}
+	// o is the options of the check, to report as it does
+	var o *options
+	opts = append(opts[:len(opts):len(opts)], onLeak(func(leaked []*Goroutine) {
+		for _, g := range leaked {
+			reported[g.ID] = true
+		}
+	}), func(co *options) { o = co })
+	check := Check(t, opts...)
+	t = o.reporter(t)
+	if name := testName(t); name != "" {
+		t = namedReporter{ErrorReporter: t, name: name}
+	}
+	return func() {
+		shutdownHooks.Lock()
+		hooks := shutdownHooks.byPackage[pkg]
+		shutdownHooks.Unlock()
+		for _, h := range hooks {
+			h.stop()
+		}
+		// goroutines started before the check get its grace period too
+		deadline := time.Now().Add(o.timeout)
+		check()
+
+		var running []*Goroutine
+		inPackage := createdInPackage(pkg + "/...")
+		for {
+			running = running[:0]
+			for _, g := range interestingGoroutines(t, o) {
+				if inPackage(g) && !reported[g.ID] {
+					running = append(running, g)
+				}
+			}
+			if len(running) == 0 {
+				return
+			}
+			if !time.Now().Before(deadline) {
+				break
+			}
+			time.Sleep(o.pollInterval())
+		}
+		if len(hooks) == 0 {
+			t.Errorf("leaktest: %d goroutine(s) created by %s, which registered no shutdown hook with RegisterShutdown:\n%s",
+				len(running), pkg, formatGroups(groupGoroutines(running)))
+			return
+		}
+		names := make([]string, len(hooks))
+		for i, h := range hooks {
+			names[i] = h.name
+		}
+		t.Errorf("leaktest: %d goroutine(s) created by %s still running after its shutdown hooks %s:\n%s",
+			len(running), pkg, strings.Join(names, ", "), formatGroups(groupGoroutines(running)))
+	}
+}
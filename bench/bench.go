@@ -0,0 +1,141 @@
+// Package bench measures the overhead of goleaker on synthetic workloads,
+// so users can profile it in their own environment and changes to the
+// capture and parse paths can be checked for regressions:
+//
+//	func BenchmarkLeakCheck(b *testing.B) {
+//		bench.Check(b, bench.Workload{Goroutines: 10000, Leaked: 10})
+//	}
+package bench
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// Workload describes the goroutines of a benchmark.
+type Workload struct {
+	// Goroutines is the number of goroutines running throughout, which
+	// every capture has to dump and parse.
+	Goroutines int
+	// Leaked is the number of goroutines started after the baseline and
+	// still running when Check checks.
+	Leaked int
+	// Depth is the number of frames in the stack of every goroutine,
+	// 1 for the minimum.
+	Depth int
+}
+
+// Start starts n goroutines parked Depth frames deep and returns a func
+// stopping them and waiting for them to exit.
+func (w Workload) Start(n int) (stop func()) {
+	done := make(chan struct{})
+	running := runtime.NumGoroutine() + n
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			park(w.Depth, done)
+		}()
+	}
+	waitRunning(running)
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+//go:noinline
+func park(depth int, done chan struct{}) {
+	if depth > 1 {
+		park(depth-1, done)
+		return
+	}
+	<-done
+}
+
+// waitRunning waits a little for n goroutines to be running.
+func waitRunning(n int) {
+	for i := 0; i < 100 && runtime.NumGoroutine() < n; i++ {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Dump returns the goroutine dump of the process running w.Goroutines
+// extra goroutines on top of its own.
+func (w Workload) Dump() string {
+	stop := w.Start(w.Goroutines)
+	defer stop()
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// Capture measures a capture of the goroutines of the running process
+// running w.Goroutines extra goroutines, as taken on every poll of a
+// check.
+func Capture(b *testing.B, w Workload) {
+	stop := w.Start(w.Goroutines)
+	defer stop()
+	s := goleaker.RuntimeSource()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Capture(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Parse measures parsing the dump of w.Goroutines goroutines from
+// scratch, as a Source reading dumps does.
+func Parse(b *testing.B, w Workload) {
+	dump := w.Dump()
+	b.SetBytes(int64(len(dump)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := goleaker.ParseDump(dump); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Check measures a complete check with w.Goroutines goroutines running
+// throughout and w.Leaked goroutines leaked, which fails and reports them
+// when Leaked is positive. Starting and stopping the leaked goroutines is
+// not measured. opts configure the check, e.g. goleaker.WithSampling.
+func Check(b *testing.B, w Workload, opts ...goleaker.Option) {
+	stop := w.Start(w.Goroutines)
+	defer stop()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := &discard{}
+		check := goleaker.Check(r, opts...)
+		b.StopTimer()
+		leaked := w.Start(w.Leaked)
+		b.StartTimer()
+		check()
+		b.StopTimer()
+		leaked()
+		if w.Leaked > 0 && r.n == 0 {
+			b.Fatalf("%d leaked goroutines not reported", w.Leaked)
+		}
+		b.StartTimer()
+	}
+}
+
+// discard counts errors and drops them.
+type discard struct{ n int }
+
+func (d *discard) Errorf(string, ...interface{}) { d.n++ }
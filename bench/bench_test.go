@@ -0,0 +1,48 @@
+package bench
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// workloads are the fixed sizes the benchmarks run at, so their results
+// can be compared across changes with benchstat.
+var workloads = []Workload{
+	{Goroutines: 100, Depth: 1},
+	{Goroutines: 1000, Depth: 8},
+	{Goroutines: 10000, Depth: 8},
+}
+
+// name names the sub-benchmark of w.
+func name(w Workload) string {
+	return fmt.Sprintf("goroutines=%d/depth=%d/leaked=%d", w.Goroutines, w.Depth, w.Leaked)
+}
+
+func BenchmarkCapture(b *testing.B) {
+	for _, w := range workloads {
+		b.Run(name(w), func(b *testing.B) { Capture(b, w) })
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, w := range workloads {
+		b.Run(name(w), func(b *testing.B) { Parse(b, w) })
+	}
+}
+
+func BenchmarkCheck(b *testing.B) {
+	for _, w := range workloads {
+		b.Run(name(w), func(b *testing.B) { Check(b, w) })
+		w.Leaked = 10
+		b.Run(name(w), func(b *testing.B) { Check(b, w, goleaker.WithTimeout(10*time.Millisecond)) })
+	}
+}
+
+func BenchmarkCheckSampling(b *testing.B) {
+	for _, w := range workloads {
+		b.Run(name(w), func(b *testing.B) { Check(b, w, goleaker.WithSampling()) })
+	}
+}
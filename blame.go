@@ -0,0 +1,135 @@
+package goleaker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Blame is the last change of a line of code, as a BlameProvider knows
+// it.
+type Blame struct {
+	Commit string    `json:"commit"`
+	Author string    `json:"author,omitempty"`
+	Time   time.Time `json:"time,omitzero"`
+}
+
+func (b Blame) String() string {
+	s := "last changed in " + b.Commit
+	if len(b.Commit) > 12 {
+		s = "last changed in " + b.Commit[:12]
+	}
+	if b.Author != "" {
+		s += " by " + b.Author
+	}
+	if !b.Time.IsZero() {
+		s += " on " + b.Time.Format(time.DateOnly)
+	}
+	return s
+}
+
+// BlameProvider returns the last change of a line of a source file, false
+// when it does not know it.
+type BlameProvider func(file string, line int) (Blame, bool)
+
+// WithBlame adds to reports the last change, according to p, of the line
+// which started every leaked goroutine, e.g. "last changed in 1a2b3c4d5e6f
+// by Jane Doe on 2026-10-01", to route failures to whoever most likely
+// introduced the leak. GitBlame provides it from git.
+func WithBlame(p BlameProvider) Option {
+	return func(o *options) {
+		o.blame = p
+	}
+}
+
+// GitBlame returns a BlameProvider running git blame in the repository of
+// each file, caching the results. Lines outside of repositories and lines
+// not committed yet are unknown.
+func GitBlame() BlameProvider {
+	var cache sync.Map
+	return func(file string, line int) (Blame, bool) {
+		key := file + ":" + strconv.Itoa(line)
+		if b, ok := cache.Load(key); ok {
+			b := b.(*Blame)
+			return *b, b.Commit != ""
+		}
+		b := gitBlame(file, line)
+		cache.Store(key, &b)
+		return b, b.Commit != ""
+	}
+}
+
+func gitBlame(file string, line int) Blame {
+	out, err := exec.Command("git", "-C", filepath.Dir(file), "blame", "--porcelain",
+		"-L", fmt.Sprintf("%d,%d", line, line), "--", filepath.Base(file)).Output()
+	if err != nil {
+		return Blame{}
+	}
+	var b Blame
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for first := true; sc.Scan(); first = false {
+		text := sc.Text()
+		if first {
+			b.Commit, _, _ = strings.Cut(text, " ")
+			continue
+		}
+		key, value, _ := strings.Cut(text, " ")
+		switch key {
+		case "author":
+			b.Author = value
+		case "author-time":
+			if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+				b.Time = time.Unix(sec, 0)
+			}
+		}
+	}
+	if strings.Trim(b.Commit, "0") == "" {
+		return Blame{}
+	}
+	return b
+}
+
+// creationSite returns the file and line of the go statement in the
+// "created by" lines of a goroutine stack.
+func creationSite(stack string) (string, int, bool) {
+	i := strings.Index(stack, "\ncreated by ")
+	if i < 0 {
+		return "", 0, false
+	}
+	lines := strings.SplitN(stack[i+1:], "\n", 3)
+	if len(lines) < 2 || !strings.HasPrefix(lines[1], "\t") {
+		return "", 0, false
+	}
+	loc := strings.TrimSpace(lines[1])
+	if j := strings.LastIndex(loc, " +0x"); j >= 0 {
+		loc = loc[:j]
+	}
+	j := strings.LastIndexByte(loc, ':')
+	if j < 0 {
+		return "", 0, false
+	}
+	line, err := strconv.Atoi(loc[j+1:])
+	return loc[:j], line, err == nil
+}
+
+// blameOf returns the last change of the line which started g, if
+// WithBlame knows it.
+func (o *options) blameOf(g *Goroutine) *Blame {
+	if o.blame == nil {
+		return nil
+	}
+	file, line, ok := creationSite(g.Stack)
+	if !ok {
+		return nil
+	}
+	if b, ok := o.blame(file, line); ok {
+		return &b
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package goleaker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// cancels are the contexts made by WithCancelTracked whose cancel func
+// was not called yet, with the stacks that made them.
+var cancels struct {
+	sync.Mutex
+	seq     uint64
+	pending map[uint64]string
+}
+
+// WithCancelTracked is the same as context.WithCancel, but records the
+// stack creating the context until its cancel func is called, for
+// CheckCancels to report the ones never canceled. Such contexts are
+// released only with their parent, and the goroutines watching them with
+// it.
+func WithCancelTracked(ctx context.Context) (context.Context, context.CancelFunc) {
+	stack := callerStack(3)
+	ctx, cancel := context.WithCancel(ctx)
+	cancels.Lock()
+	if cancels.pending == nil {
+		cancels.pending = map[uint64]string{}
+	}
+	cancels.seq++
+	seq := cancels.seq
+	cancels.pending[seq] = stack
+	cancels.Unlock()
+	return ctx, func() {
+		cancels.Lock()
+		delete(cancels.pending, seq)
+		cancels.Unlock()
+		cancel()
+	}
+}
+
+// CheckCancels returns a function to be run at the end of tests which
+// reports the contexts made by WithCancelTracked since whose cancel func
+// was never called, grouped by the stack that made them. Contexts made by
+// parallel tests or background code in the meantime count as well, so the
+// check suits tests that do not run in parallel best.
+func CheckCancels(t ErrorReporter, opts ...Option) func() {
+	o := newOptions(opts)
+	if o.testName = testName(t); o.testName != "" {
+		t = namedReporter{ErrorReporter: t, name: o.testName}
+	}
+	cancels.Lock()
+	since := cancels.seq
+	cancels.Unlock()
+	return func() {
+		cancels.Lock()
+		var seqs []uint64
+		for seq := range cancels.pending {
+			if seq > since {
+				seqs = append(seqs, seq)
+			}
+		}
+		sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+		var stacks []string
+		count := map[string]int{}
+		for _, seq := range seqs {
+			stack := cancels.pending[seq]
+			if count[stack] == 0 {
+				stacks = append(stacks, stack)
+			}
+			count[stack]++
+		}
+		cancels.Unlock()
+		for _, stack := range stacks {
+			o.reportFinding(t, Finding{Kind: "cancel func", Message: fmt.Sprintf("cancel func of %d context(s) never called", count[stack]), Stack: stack})
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package goleaker
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// CheckCeiling samples the number of goroutines every poll interval and
+// returns a function to be run at the end of tests which reports if it
+// ever exceeded max. Unbounded fan-out does not always leak, since the
+// goroutines may eventually exit, but it still deserves a failure.
+func CheckCeiling(t ErrorReporter, max int, opts ...Option) func() {
+	o := newOptions(opts)
+	if o.testName = testName(t); o.testName != "" {
+		t = namedReporter{ErrorReporter: t, name: o.testName}
+	}
+	c := &ceiling{max: max, interval: o.pollInterval(), stop: make(chan struct{}), peak: runtime.NumGoroutine()}
+	c.wg.Add(1)
+	go c.sample()
+	return func() {
+		close(c.stop)
+		c.wg.Wait()
+		if c.peak > c.max {
+			o.reportFinding(t, Finding{Kind: "goroutine ceiling", Message: fmt.Sprintf("goroutine ceiling of %d exceeded, peaked at %s goroutines during test",
+				c.max, formatCount(c.peak))})
+		}
+	}
+}
+
+type ceiling struct {
+	max      int
+	interval time.Duration
+	peak     int
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// sample records the peak every interval and once more when stopped, so
+// a peak reached since the last tick is not missed.
+func (c *ceiling) sample() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.observe()
+		case <-c.stop:
+			c.observe()
+			return
+		}
+	}
+}
+
+func (c *ceiling) observe() {
+	if n := runtime.NumGoroutine(); n > c.peak {
+		c.peak = n
+	}
+}
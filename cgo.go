@@ -0,0 +1,77 @@
+package goleaker
+
+import "strings"
+
+type cgoPolicy int
+
+const (
+	// cgoDefault reports cgo goroutines with a Go stack and ignores the
+	// ones running C code without one.
+	cgoDefault cgoPolicy = iota
+	cgoIgnore
+	cgoFail
+)
+
+// IgnoreCgo ignores every goroutine calling into C or running a cgo
+// callback, for tests of packages embedding a C library whose threads
+// outlive them by design.
+func IgnoreCgo() Option {
+	return func(o *options) {
+		o.cgo = cgoIgnore
+	}
+}
+
+// FailOnCgo reports every goroutine calling into C or running a cgo
+// callback, including the ones whose stack is unavailable because they
+// run C code on another thread, which are ignored by default.
+func FailOnCgo() Option {
+	return func(o *options) {
+		o.cgo = cgoFail
+	}
+}
+
+// cgoIgnored reports whether the cgo policy of o ignores g.
+func (o *options) cgoIgnored(g *Goroutine) bool {
+	switch o.cgo {
+	case cgoIgnore:
+		return cgoOpaque(g) || cgoEntry(g) != ""
+	case cgoFail:
+		return false
+	}
+	return cgoOpaque(g)
+}
+
+// cgoOpaque reports whether g runs C code without a Go stack to show.
+func cgoOpaque(g *Goroutine) bool {
+	return strings.Contains(g.body(), "goroutine in C code")
+}
+
+// cgoEntry describes the cgo boundary g crossed, the C function it called
+// as in "call to C.sqlite3_step", or the Go function C called back as in
+// "callback to main.onEvent from C.run", or returns "" for goroutines
+// without one.
+func cgoEntry(g *Goroutine) string {
+	for i, f := range g.Frames {
+		_, fn, _ := strings.Cut(f.Func[strings.LastIndexByte(f.Func, '/')+1:], ".")
+		if name, ok := strings.CutPrefix(fn, "_Cfunc_"); ok {
+			// tracebacks hide the frames of the callback machinery
+			if i > 0 && !strings.HasPrefix(g.Frames[i-1].Func, "runtime.") {
+				return "callback to " + g.Frames[i-1].Func + " from C." + name
+			}
+			return "call to C." + name
+		}
+		if name, ok := strings.CutPrefix(fn, "_cgoexp_"); ok {
+			// _cgoexp_<hash>_<name>
+			if j := strings.IndexByte(name, '_'); j >= 0 {
+				name = name[j+1:]
+			}
+			return "callback to " + funcPackage(f.Func) + "." + name
+		}
+	}
+	for _, f := range g.Frames {
+		if strings.HasPrefix(f.Func, "runtime.cgocallback") {
+			return "callback from C"
+		}
+	}
+	return ""
+}
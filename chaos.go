@@ -0,0 +1,117 @@
+package goleaker
+
+import (
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ChaosChecks is how many checks in a row have to find no leaks with
+// WithChaos.
+var ChaosChecks = 5
+
+// ChaosMaxDelay bounds the delays Chaos injects.
+var ChaosMaxDelay = 2 * time.Millisecond
+
+// chaos is the state of Chaos while checks with WithChaos wait.
+var chaos struct {
+	active atomic.Int32
+	mu     sync.Mutex
+	rng    *rand.Rand
+}
+
+// ReplaySeedEnv is the variable setting the seed of every check with
+// WithChaos, as WithReplaySeed does, to replay a failure without changing
+// the code.
+const ReplaySeedEnv = "GOLEAKER_REPLAY_SEED"
+
+// WithChaos makes a check inject random delays, drawn from seed, while it
+// waits for goroutines to exit: before every capture and in the code
+// calling Chaos. It only passes once ChaosChecks checks in a row found no
+// leaks, so shutdown races that leak now and then surface more often.
+// With a seed of zero every check draws its own. A failure reports the
+// seed, to replay with WithReplaySeed or ReplaySeedEnv; the delays drawn
+// are the same, though the schedule of the goroutines around them may
+// not be.
+func WithChaos(seed int64) Option {
+	return func(o *options) {
+		o.chaos = true
+		o.chaosSeed = seed
+	}
+}
+
+// WithReplaySeed enables WithChaos with the seed reported by a failed
+// check, taking precedence over the seed of WithChaos.
+func WithReplaySeed(seed int64) Option {
+	return func(o *options) {
+		o.chaos = true
+		o.replaySeed = &seed
+	}
+}
+
+// resolveChaosSeed returns the seed of the chaos of a check: from
+// ReplaySeedEnv, WithReplaySeed or WithChaos, in that order, or a random
+// one.
+func (o *options) resolveChaosSeed(t ErrorReporter) int64 {
+	if s := os.Getenv(ReplaySeedEnv); s != "" {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		if err == nil {
+			return seed
+		}
+		t.Errorf("leaktest: %s: %s", ReplaySeedEnv, err)
+	}
+	if o.replaySeed != nil {
+		return *o.replaySeed
+	}
+	if o.chaosSeed != 0 {
+		return o.chaosSeed
+	}
+	for {
+		if seed := rand.Int64(); seed != 0 {
+			return seed
+		}
+	}
+}
+
+// Chaos sleeps for a random delay of up to ChaosMaxDelay, or yields the
+// processor, while a check with WithChaos waits, and does nothing
+// otherwise. Code under test calls it at the points where a delay could
+// change the outcome of a shutdown, e.g. between closing a channel and
+// waiting for its readers.
+func Chaos() {
+	if chaos.active.Load() == 0 {
+		return
+	}
+	chaos.mu.Lock()
+	var d time.Duration
+	if chaos.rng != nil && chaos.rng.IntN(4) > 0 {
+		d = time.Duration(chaos.rng.Int64N(int64(ChaosMaxDelay) + 1))
+	}
+	chaos.mu.Unlock()
+	if d == 0 {
+		runtime.Gosched()
+		return
+	}
+	time.Sleep(d)
+}
+
+// startChaos activates Chaos with the seed and returns the function
+// deactivating it. With several checks active, the first seed is kept.
+func startChaos(seed int64) func() {
+	chaos.mu.Lock()
+	if chaos.active.Add(1) == 1 {
+		chaos.rng = rand.New(rand.NewPCG(uint64(seed), 0))
+	}
+	chaos.mu.Unlock()
+	return func() {
+		chaos.mu.Lock()
+		if chaos.active.Add(-1) == 0 {
+			chaos.rng = nil
+		}
+		chaos.mu.Unlock()
+	}
+}
@@ -0,0 +1,145 @@
+package goleaker
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChildProcessGracePeriod is how long CheckChildProcesses waits for the
+// children to exit and be waited for unless WithTimeout says otherwise.
+var ChildProcessGracePeriod = time.Second
+
+// childProcess is a child of the process.
+type childProcess struct {
+	pid     int
+	command string
+	// zombie is set once the child exited without being waited for.
+	zombie bool
+}
+
+// commands are the commands made by Command and CommandContext, with the
+// stacks that made them, until they are waited for.
+var commands struct {
+	sync.Mutex
+	stacks map[*exec.Cmd]string
+}
+
+// Command is the same as exec.Command, but records the stack creating the
+// command for CheckChildProcesses to report if it lingers.
+func Command(name string, args ...string) *exec.Cmd {
+	return trackCommand(exec.Command(name, args...))
+}
+
+// CommandContext is the same as exec.CommandContext, but records the stack
+// creating the command for CheckChildProcesses to report if it lingers.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return trackCommand(exec.CommandContext(ctx, name, args...))
+}
+
+func trackCommand(cmd *exec.Cmd) *exec.Cmd {
+	commands.Lock()
+	defer commands.Unlock()
+	if commands.stacks == nil {
+		commands.stacks = map[*exec.Cmd]string{}
+	}
+	commands.stacks[cmd] = callerStack(4)
+	return cmd
+}
+
+// callerStack formats the stack of the calling goroutine, leaving out
+// skip frames as runtime.Callers does.
+func callerStack(skip int) string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(skip, pcs)])
+	var b strings.Builder
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s()\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			return strings.TrimSuffix(b.String(), "\n")
+		}
+	}
+}
+
+// commandStacks returns the creation stacks of the tracked commands by
+// pid, and forgets the commands waited for. Commands still being started
+// by another goroutine are missed.
+func commandStacks() map[int]string {
+	commands.Lock()
+	defer commands.Unlock()
+	stacks := map[int]string{}
+	for cmd, stack := range commands.stacks {
+		switch {
+		case cmd.ProcessState != nil:
+			delete(commands.stacks, cmd)
+		case cmd.Process != nil:
+			stacks[cmd.Process.Pid] = stack
+		}
+	}
+	return stacks
+}
+
+// CheckChildProcesses snapshots the child processes and returns a function
+// to be run at the end of tests which reports the children started since
+// that are still running, or exited without being waited for, after
+// ChildProcessGracePeriod. Commands made with Command or CommandContext
+// are reported with the stack that made them. Commands started but never
+// waited for often come with leaked goroutines copying their output.
+// Child processes are only listed on Linux.
+func CheckChildProcesses(t ErrorReporter, opts ...Option) func() {
+	o := newOptions(opts)
+	t = o.reporter(t)
+	if o.testName = testName(t); o.testName != "" {
+		t = namedReporter{ErrorReporter: t, name: o.testName}
+	}
+	before := map[int]bool{}
+	children, ok := childProcesses()
+	for _, c := range children {
+		before[c.pid] = true
+	}
+	return func() {
+		if !ok {
+			return
+		}
+		grace := scaled(ChildProcessGracePeriod)
+		if o.hasTimeout {
+			grace = o.timeout
+		}
+		deadline := time.Now().Add(grace)
+		for {
+			var lingering []childProcess
+			children, _ := childProcesses()
+			for _, c := range children {
+				if !before[c.pid] {
+					lingering = append(lingering, c)
+				}
+			}
+			if len(lingering) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				reportChildren(t, o, lingering)
+				return
+			}
+			time.Sleep(o.pollInterval())
+		}
+	}
+}
+
+func reportChildren(t ErrorReporter, o *options, children []childProcess) {
+	sort.Slice(children, func(i, j int) bool { return children[i].pid < children[j].pid })
+	stacks := commandStacks()
+	for _, c := range children {
+		status := "still running"
+		if c.zombie {
+			status = "exited but was never waited for"
+		}
+		o.reportFinding(t, Finding{Kind: "child process", Message: fmt.Sprintf("child process %d (%s) %s", c.pid, c.command, status), Stack: stacks[c.pid]})
+	}
+}
@@ -0,0 +1,52 @@
+package goleaker
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// childProcesses lists the children of the process from the stat files
+// of /proc.
+func childProcesses() ([]childProcess, bool) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, false
+	}
+	self := os.Getpid()
+	var children []childProcess
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + e.Name() + "/stat")
+		if err != nil {
+			// exited since
+			continue
+		}
+		// pid (comm) state ppid ..., where comm may hold spaces and
+		// parentheses
+		i := bytes.LastIndexByte(stat, ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[i+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		if ppid, _ := strconv.Atoi(fields[1]); ppid != self {
+			continue
+		}
+		c := childProcess{pid: pid, zombie: fields[0] == "Z"}
+		if j := bytes.IndexByte(stat, '('); j >= 0 {
+			c.command = string(stat[j+1 : i])
+		}
+		if cmdline, err := os.ReadFile("/proc/" + e.Name() + "/cmdline"); err == nil && len(cmdline) > 0 {
+			c.command = strings.ReplaceAll(strings.TrimRight(string(cmdline), "\x00"), "\x00", " ")
+		}
+		children = append(children, c)
+	}
+	return children, true
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package goleaker
+
+func childProcesses() ([]childProcess, bool) {
+	return nil, false
+}
@@ -0,0 +1,82 @@
+package goleaker
+
+import "strings"
+
+// LeakClass is the kind of blocking a leaked goroutine is stuck in, for
+// policies and dashboards keyed by the class of a leak.
+type LeakClass string
+
+// The leak classes, as assigned by Class.
+const (
+	ClassBlockedSend   LeakClass = "BLOCKED_SEND"
+	ClassBlockedRecv   LeakClass = "BLOCKED_RECV"
+	ClassBlockedSelect LeakClass = "BLOCKED_SELECT"
+	ClassSelectNoCase  LeakClass = "SELECT_NO_CASE"
+	ClassSleep         LeakClass = "SLEEP"
+	ClassSleepLoop     LeakClass = "SLEEP_LOOP"
+	ClassNetworkRead   LeakClass = "NETWORK_READ"
+	ClassLockWait      LeakClass = "LOCK_WAIT"
+	ClassUnknown       LeakClass = "UNKNOWN"
+)
+
+// Class returns the class of g from its wait reason and frames. A single
+// stack cannot tell a polling loop from one long sleep, so sleeping
+// goroutines are ClassSleep; checks report ClassSleepLoop for those seen
+// sleeping under the same caller across polls.
+func (g *Goroutine) Class() LeakClass {
+	switch g.State {
+	case "chan send", "chan send (nil chan)":
+		return ClassBlockedSend
+	case "chan receive", "chan receive (nil chan)":
+		return ClassBlockedRecv
+	case "select":
+		return ClassBlockedSelect
+	case "select (no cases)":
+		return ClassSelectNoCase
+	case "sleep":
+		return ClassSleep
+	case "semacquire", "sync.Mutex.Lock", "sync.RWMutex.Lock", "sync.RWMutex.RLock",
+		"sync.Cond.Wait", "sync.WaitGroup.Wait":
+		return ClassLockWait
+	case "IO wait":
+		for _, f := range g.Frames {
+			if strings.HasPrefix(f.Func, "net.") || strings.HasPrefix(f.Func, "crypto/tls.") {
+				return ClassNetworkRead
+			}
+		}
+	}
+	return ClassUnknown
+}
+
+// class returns the class of g, ClassSleepLoop if the polls of the check
+// saw it sleeping in a loop.
+func (o *options) class(g *Goroutine) LeakClass {
+	if o.sleepers.loop(g) {
+		return ClassSleepLoop
+	}
+	return g.Class()
+}
+
+// leakGroups groups gs as groupGoroutines does, with the classes of the
+// check.
+func (o *options) leakGroups(gs []*Goroutine) []*group {
+	groups := groupGoroutines(gs)
+	for _, gr := range groups {
+		gr.class = o.class(gr.goroutines[0])
+	}
+	return groups
+}
+
+// Class matches goroutines of one of the classes. Matchers see a single
+// stack, so a goroutine in a time.Sleep loop is of ClassSleep to them.
+func Class(classes ...LeakClass) Matcher {
+	return func(g *Goroutine) bool {
+		c := g.Class()
+		for _, class := range classes {
+			if c == class {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rfyiamcool/goleaker"
+	"github.com/rfyiamcool/goleaker/remote"
+)
+
+func analyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: goleaker analyze [flags] [dump file]\n\n"+
+			"Reports the goroutines of a stack dump, read from the file, stdin or one of\n"+
+			"the sources below, that the rules do not ignore. -pid and -docker send\n"+
+			"SIGQUIT, which makes Go programs exit after dumping their goroutines.")
+		fs.PrintDefaults()
+	}
+	config := fs.String("config", "", "rules `file` in the format of goleaker config files")
+	url := fs.String("url", "", "capture from the net/http/pprof endpoint at `url`")
+	pid := fs.Int("pid", 0, "dump the process `pid`, whose stderr must be a file, from any PID namespace")
+	container := fs.String("docker", "", "dump the main process of `container` and read the dump from its logs")
+	containerPID := fs.Int("container-pid", 0, "with -docker, dump the process `pid` of the container instead, through docker exec")
+	docker := fs.String("docker-cmd", "docker", "docker compatible `command`, e.g. podman")
+	wait := fs.Duration("wait", 10*time.Second, "how long to wait for a dump")
+	verbose := fs.Bool("v", false, "print the stack of every goroutine")
+	fs.Parse(args)
+
+	var opts []goleaker.Option
+	if *config != "" {
+		c, err := goleaker.LoadConfig(*config)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, c.Option())
+	}
+
+	var (
+		gs  []goleaker.Goroutine
+		err error
+	)
+	switch {
+	case *url != "":
+		gs, err = remote.Fetch(context.Background(), *url)
+	case *pid != 0:
+		gs, err = parse(dumpPID(*pid, *wait))
+	case *container != "":
+		gs, err = parse(dumpContainer(*docker, *container, *containerPID, *wait))
+	case fs.NArg() > 0:
+		gs, err = parse(os.ReadFile(fs.Arg(0)))
+	default:
+		gs, err = parse(io.ReadAll(os.Stdin))
+	}
+	if err != nil && len(gs) == 0 {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goleaker: %s\n", err)
+	}
+	return report(os.Stdout, goleaker.Interesting(gs, opts...), *verbose)
+}
+
+func parse(dump []byte, err error) ([]goleaker.Goroutine, error) {
+	if err != nil {
+		return nil, err
+	}
+	return goleaker.ParseDump(string(dump))
+}
+
+// report writes one line per signature, the most goroutines first, and
+// with verbose the stack of every goroutine.
+func report(w io.Writer, gs []*goleaker.Goroutine, verbose bool) error {
+	type sig struct {
+		id, state, top, created string
+		class                   goleaker.LeakClass
+		n                       int
+	}
+	bySig := map[string]*sig{}
+	var sigs []*sig
+	for _, g := range gs {
+		id := g.SignatureID()
+		s := bySig[id]
+		if s == nil {
+			s = &sig{id: id, state: g.State, class: g.Class(), created: g.CreatedBy}
+			if len(g.Frames) > 0 {
+				s.top = g.Frames[0].Func
+			}
+			bySig[id] = s
+			sigs = append(sigs, s)
+		}
+		s.n++
+	}
+	sort.SliceStable(sigs, func(i, j int) bool { return sigs[i].n > sigs[j].n })
+
+	fmt.Fprintf(w, "%d goroutine(s) with %d signature(s)\n", len(gs), len(sigs))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "count\tsig\tclass\tstate\ttop\tcreated by")
+	for _, s := range sigs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", s.n, s.id, s.class, s.state, s.top, s.created)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if verbose {
+		for _, g := range gs {
+			if _, err := fmt.Fprintf(w, "\n%s\n", g.Stack); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
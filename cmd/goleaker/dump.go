@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// settle is how long a dump has to stop growing to count as complete.
+const settle = 500 * time.Millisecond
+
+// dumpPID sends SIGQUIT to pid and reads the goroutine dump the Go runtime
+// appends to its stderr, which has to be a regular file for that.
+func dumpPID(pid int, wait time.Duration) ([]byte, error) {
+	stderr := fmt.Sprintf("/proc/%d/fd/2", pid)
+	f, err := os.Open(stderr)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("stderr of process %d is not a file, capture it with -url or -docker instead", pid)
+	}
+	offset := fi.Size()
+	if err := quit(pid); err != nil {
+		return nil, err
+	}
+	return await(wait, func() ([]byte, error) {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		dump := make([]byte, fi.Size()-offset)
+		_, err = f.ReadAt(dump, offset)
+		return dump, err
+	})
+}
+
+// dumpContainer sends SIGQUIT to the main process of container, or to
+// pid inside of it, and reads the dump from the container logs.
+func dumpContainer(docker, container string, pid int, wait time.Duration) ([]byte, error) {
+	since := time.Now().Add(-time.Second).Format(time.RFC3339Nano)
+	var quit *exec.Cmd
+	if pid != 0 {
+		quit = exec.Command(docker, "exec", container, "kill", "-QUIT", strconv.Itoa(pid))
+	} else {
+		quit = exec.Command(docker, "kill", "--signal=QUIT", container)
+	}
+	if out, err := quit.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %s", err, bytes.TrimSpace(out))
+	}
+	return await(wait, func() ([]byte, error) {
+		// the dump is written to stderr, which docker logs passes on
+		var logs bytes.Buffer
+		cmd := exec.Command(docker, "logs", "--since", since, container)
+		cmd.Stderr = &logs
+		err := cmd.Run()
+		return logs.Bytes(), err
+	})
+}
+
+// await reads a growing dump with read until it stopped growing for
+// settle, or until wait elapsed.
+func await(wait time.Duration, read func() ([]byte, error)) ([]byte, error) {
+	deadline := time.Now().Add(wait)
+	var (
+		dump    []byte
+		changed = time.Now()
+	)
+	for {
+		time.Sleep(100 * time.Millisecond)
+		next, err := read()
+		if err != nil {
+			return nil, err
+		}
+		if len(next) != len(dump) {
+			dump, changed = next, time.Now()
+		}
+		if len(dump) > 0 && time.Since(changed) >= settle {
+			return dump, nil
+		}
+		if time.Now().After(deadline) {
+			if len(dump) == 0 {
+				return nil, fmt.Errorf("no goroutine dump after %v", wait)
+			}
+			return dump, nil
+		}
+	}
+}
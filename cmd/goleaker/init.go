@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	goleakerPath = "github.com/rfyiamcool/goleaker"
+	// generatedMarker marks the TestMain files written by init, which it
+	// rewrites when run again, e.g. with new options.
+	generatedMarker = "// Code generated by goleaker init. DO NOT EDIT."
+)
+
+// optionFlags collects the repeated -option flag.
+type optionFlags []string
+
+func (f *optionFlags) String() string { return strings.Join(*f, ", ") }
+
+func (f *optionFlags) Set(expr string) error {
+	if _, err := parser.ParseExpr(expr); err != nil {
+		return fmt.Errorf("option %q: %w", expr, err)
+	}
+	*f = append(*f, expr)
+	return nil
+}
+
+func initCmd(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: goleaker init [flags] [packages]\n\n"+
+			"Makes the TestMain of every package with tests call goleaker.VerifyTestMain,\n"+
+			"creating a TestMain file where there is none and patching TestMain functions\n"+
+			"that run os.Exit(m.Run()). Packages default to ./...")
+		fs.PrintDefaults()
+	}
+	var options optionFlags
+	fs.Var(&options, "option", "goleaker option `expression` to pass VerifyTestMain, e.g.\n"+
+		"'goleaker.IgnorePackages(\"go.opencensus.io/...\")'; repeat for more")
+	file := fs.String("file", "goleaker_main_test.go", "`name` of the TestMain files created")
+	dryRun := fs.Bool("n", false, "print the changes without writing them")
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	pkgs, err := listPackages(patterns)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		action, path, err := initPackage(pkg, *file, options, *dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "goleaker: %s: %s\n", pkg.ImportPath, err)
+			continue
+		}
+		if action != "" {
+			fmt.Printf("%s %s\n", action, path)
+		}
+	}
+	return nil
+}
+
+// listedPackage is the part of go list -json init uses.
+type listedPackage struct {
+	Dir, ImportPath, Name     string
+	TestGoFiles, XTestGoFiles []string
+}
+
+func listPackages(patterns []string) ([]listedPackage, error) {
+	cmd := exec.Command("go", append([]string{"list", "-json"}, patterns...)...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %w", err)
+	}
+	var pkgs []listedPackage
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg listedPackage
+		if err := dec.Decode(&pkg); err == io.EOF {
+			return pkgs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+}
+
+// verifyCall returns the call of VerifyTestMain with the options, on the
+// *testing.M named m.
+func verifyCall(m string, options []string) string {
+	return "goleaker.VerifyTestMain(" + strings.Join(append([]string{m}, options...), ", ") + ")"
+}
+
+// initPackage makes the TestMain of pkg call VerifyTestMain with the
+// options, and returns what it did to which file: "created", "updated" or
+// "patched", or "" when there was nothing to do.
+func initPackage(pkg listedPackage, name string, options []string, dryRun bool) (string, string, error) {
+	if len(pkg.TestGoFiles)+len(pkg.XTestGoFiles) == 0 || pkg.ImportPath == goleakerPath {
+		return "", "", nil
+	}
+	var files []string
+	for _, f := range append(pkg.TestGoFiles, pkg.XTestGoFiles...) {
+		files = append(files, filepath.Join(pkg.Dir, f))
+	}
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", err
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return "", "", err
+		}
+		fn := findTestMain(f)
+		if fn == nil {
+			continue
+		}
+		if bytes.HasPrefix(src, []byte(generatedMarker)) {
+			out, err := testMainFile(f.Name.Name, options)
+			if err != nil || bytes.Equal(out, src) {
+				return "", "", err
+			}
+			return "updated", path, write(path, out, dryRun)
+		}
+		out, err := patchTestMain(fset, f, fn, src, options)
+		if err != nil || out == nil {
+			return "", "", err
+		}
+		return "patched", path, write(path, out, dryRun)
+	}
+
+	pkgName := pkg.Name
+	if len(pkg.TestGoFiles) == 0 {
+		pkgName += "_test"
+	}
+	out, err := testMainFile(pkgName, options)
+	if err != nil {
+		return "", "", err
+	}
+	path := filepath.Join(pkg.Dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return "", "", fmt.Errorf("%s already exists", path)
+	}
+	return "created", path, write(path, out, dryRun)
+}
+
+func findTestMain(f *ast.File) *ast.FuncDecl {
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "TestMain" && fn.Body != nil {
+			return fn
+		}
+	}
+	return nil
+}
+
+func testMainFile(pkgName string, options []string) ([]byte, error) {
+	src := fmt.Sprintf("%s\n\npackage %s\n\nimport (\n\t\"testing\"\n\n\t%q\n)\n\nfunc TestMain(m *testing.M) {\n\t%s\n}\n",
+		generatedMarker, pkgName, goleakerPath, verifyCall("m", options))
+	return format.Source([]byte(src))
+}
+
+// patchTestMain replaces the os.Exit(m.Run()) statement of fn with a call
+// of VerifyTestMain and imports goleaker. It returns nil when fn already
+// calls VerifyTestMain.
+func patchTestMain(fset *token.FileSet, f *ast.File, fn *ast.FuncDecl, src []byte, options []string) ([]byte, error) {
+	if strings.Contains(string(src[fset.Position(fn.Pos()).Offset:fset.Position(fn.End()).Offset]), ".VerifyTestMain(") {
+		return nil, nil
+	}
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) != 1 {
+		return nil, errors.New("TestMain does not take a *testing.M")
+	}
+	m := params[0].Names[0].Name
+	var exit ast.Stmt
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		stmt, ok := n.(*ast.ExprStmt)
+		if !ok || exit != nil {
+			return exit == nil
+		}
+		if outer, ok := stmt.X.(*ast.CallExpr); ok && isCall(outer, "os", "Exit") && len(outer.Args) == 1 {
+			if inner, ok := outer.Args[0].(*ast.CallExpr); ok && isCall(inner, m, "Run") {
+				exit = stmt
+			}
+		}
+		return true
+	})
+	if exit == nil {
+		return nil, errors.New("TestMain does not run os.Exit(" + m + ".Run()), call goleaker.VerifyTestMain by hand")
+	}
+
+	start, end := fset.Position(exit.Pos()).Offset, fset.Position(exit.End()).Offset
+	out := append(append(append([]byte{}, src[:start]...), verifyCall(m, options)...), src[end:]...)
+	if !imports(f, goleakerPath) {
+		out = addImport(fset, f, out, goleakerPath)
+	}
+	return dropUnusedImport(out, "os")
+}
+
+func isCall(call *ast.CallExpr, x, sel string) bool {
+	s, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || s.Sel.Name != sel {
+		return false
+	}
+	id, ok := s.X.(*ast.Ident)
+	return ok && id.Name == x
+}
+
+func imports(f *ast.File, path string) bool {
+	for _, imp := range f.Imports {
+		if imp.Path.Value == fmt.Sprintf("%q", path) {
+			return true
+		}
+	}
+	return false
+}
+
+// addImport adds an import of path, in its own group, to src, the source
+// of f before any edit past its imports.
+func addImport(fset *token.FileSet, f *ast.File, src []byte, path string) []byte {
+	spec := fmt.Sprintf("%q", path)
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		if gen.Rparen.IsValid() {
+			at := fset.Position(gen.Rparen).Offset
+			return append(append(append([]byte{}, src[:at]...), "\n\t"+spec+"\n"...), src[at:]...)
+		}
+		start, end := fset.Position(gen.Pos()).Offset, fset.Position(gen.End()).Offset
+		block := "import (\n\t" + string(src[start+len("import "):end]) + "\n\n\t" + spec + "\n)"
+		return append(append(append([]byte{}, src[:start]...), block...), src[end:]...)
+	}
+	at := fset.Position(f.Name.End()).Offset
+	return append(append(append([]byte{}, src[:at]...), "\n\nimport "+spec...), src[at:]...)
+}
+
+// dropUnusedImport removes the import of path, named after its last
+// element, from src when nothing refers to it anymore, and formats src.
+func dropUnusedImport(src []byte, path string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	name := path[strings.LastIndexByte(path, '/')+1:]
+	used := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Name == name {
+				used = true
+			}
+		}
+		return !used
+	})
+	var spec *ast.ImportSpec
+	for _, imp := range f.Imports {
+		if imp.Path.Value == fmt.Sprintf("%q", path) && imp.Name == nil {
+			spec = imp
+		}
+	}
+	if used || spec == nil {
+		return format.Source(src)
+	}
+	var from, to token.Pos = spec.Pos(), spec.End()
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT && len(gen.Specs) == 1 && gen.Specs[0] == spec {
+			from, to = gen.Pos(), gen.End()
+		}
+	}
+	start, end := fset.Position(from).Offset, fset.Position(to).Offset
+	return format.Source(append(append([]byte{}, src[:start]...), src[end:]...))
+}
+
+func write(path string, src []byte, dryRun bool) error {
+	if dryRun {
+		return nil
+	}
+	return os.WriteFile(path, src, 0o644)
+}
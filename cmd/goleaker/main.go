@@ -0,0 +1,59 @@
+// Command goleaker applies the leak rules of goleaker to goroutines
+// captured outside of tests: saved stack dumps, pprof endpoints,
+// processes or containers made to dump their goroutines with SIGQUIT, and
+// the failure artifacts of checks.
+//
+// Usage:
+//
+//	goleaker <command> [flags]
+//
+// Run goleaker <command> -h for the flags of a command.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a subcommand, run with the arguments following its name.
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"analyze": {"report the goroutines of a dump, endpoint, process or container", analyze},
+	"init":    {"make the TestMain of packages call VerifyTestMain", initCmd},
+	"replay":  {"rerun the check of a failure artifact with other rules", replay},
+	"tui":     {"show a live table of the goroutines of a process", tui},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "goleaker: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "goleaker: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: goleaker <command> [flags]\n\ncommands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\t%-10s %s\n", name, commands[name].summary)
+	}
+}
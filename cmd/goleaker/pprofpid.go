@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rfyiamcool/goleaker/remote"
+)
+
+// pprofEndpoint finds the net/http/pprof endpoint of the process pid among
+// the TCP ports it listens on, as told by /proc on Linux.
+func pprofEndpoint(pid int) (string, error) {
+	proc := fmt.Sprintf("/proc/%d", pid)
+	links, err := filepath.Glob(proc + "/fd/*")
+	if err != nil || len(links) == 0 {
+		return "", fmt.Errorf("cannot list the files of process %d", pid)
+	}
+	sockets := map[string]bool{}
+	for _, link := range links {
+		if target, err := os.Readlink(link); err == nil && strings.HasPrefix(target, "socket:[") {
+			sockets[strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")] = true
+		}
+	}
+	var ports []int
+	for _, table := range []string{"/net/tcp", "/net/tcp6"} {
+		ports = append(ports, listeningPorts(proc+table, sockets)...)
+	}
+	client := &http.Client{Timeout: time.Second}
+	for _, port := range ports {
+		url := fmt.Sprintf("http://127.0.0.1:%d%s", port, remote.GoroutinePath)
+		resp, err := client.Get(url + "?debug=1")
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return url, nil
+		}
+	}
+	return "", fmt.Errorf("process %d serves no net/http/pprof endpoint on its %d listening port(s), use -url", pid, len(ports))
+}
+
+// listeningPorts returns the ports of the sockets listening in a
+// /proc/net/tcp table whose inodes are among sockets.
+func listeningPorts(table string, sockets map[string]bool) []int {
+	f, err := os.Open(table)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var ports []int
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		f := strings.Fields(sc.Text())
+		if len(f) < 10 || f[3] != "0A" || !sockets[f[9]] {
+			continue
+		}
+		_, port, ok := strings.Cut(f[1], ":")
+		if !ok {
+			continue
+		}
+		if p, err := strconv.ParseUint(port, 16, 16); err == nil {
+			ports = append(ports, int(p))
+		}
+	}
+	return ports
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func quit(pid int) error {
+	return errors.New("no SIGQUIT on this platform")
+}
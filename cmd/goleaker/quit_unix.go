@@ -0,0 +1,9 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+func quit(pid int) error {
+	return syscall.Kill(pid, syscall.SIGQUIT)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+func replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: goleaker replay [flags] <artifact dir>\n\n"+
+			"Runs the leak check of a failure artifact, as written by WithFailureArtifact,\n"+
+			"again with the given rules, to try suppression rules against the exact\n"+
+			"state of the failure. Exits with 1 if goroutines are still reported.")
+		fs.PrintDefaults()
+	}
+	config := fs.String("config", "", "rules `file` in the format of goleaker config files")
+	packages := fs.String("ignore-packages", "", "comma separated package `patterns` to ignore, see IgnorePackages")
+	sigs := fs.String("ignore-sigs", "", "comma separated signature `ids` to ignore")
+	strict := fs.Bool("strict", false, "do not ignore connection loops and keepalives")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := fs.Arg(0)
+
+	opts := []goleaker.Option{goleaker.WithSource(goleaker.FileSource(
+		filepath.Join(dir, goleaker.ArtifactBaseline),
+		filepath.Join(dir, goleaker.ArtifactDump),
+	))}
+	if *config != "" {
+		c, err := goleaker.LoadConfig(*config)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, c.Option())
+	}
+	if *packages != "" {
+		opts = append(opts, goleaker.IgnorePackages(strings.Split(*packages, ",")...))
+	}
+	if *sigs != "" {
+		opts = append(opts, goleaker.Ignore(goleaker.SignatureID(strings.Split(*sigs, ",")...)))
+	}
+	if *strict {
+		opts = append(opts, goleaker.Strict())
+	}
+
+	r := &printReporter{}
+	goleaker.Check(r, opts...)()
+	if r.n > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("no leaks")
+	return nil
+}
+
+// printReporter prints errors to stdout and counts them.
+type printReporter struct{ n int }
+
+func (r *printReporter) Errorf(format string, args ...interface{}) {
+	r.n++
+	fmt.Printf(format+"\n", args...)
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rfyiamcool/goleaker"
+	"github.com/rfyiamcool/goleaker/remote"
+)
+
+// sorts are the orders the table of the tui cycles through.
+var sorts = []string{"count", "delta", "growth", "sig"}
+
+func tui(args []string) error {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: goleaker tui [flags]\n\n"+
+			"Shows a live table of the goroutine signatures of a process, refreshed every\n"+
+			"interval, with their counts, the change since the baseline and a trend.\n"+
+			"-pid looks for a net/http/pprof endpoint among the ports the process\n"+
+			"listens on, on Linux. Signatures which grew since the baseline are\n"+
+			"highlighted; -auto-baseline sets it once the count of goroutines stopped\n"+
+			"changing.\n\n"+
+			"keys: s sort, b set the baseline, x clear it, e export a report, q quit")
+		fs.PrintDefaults()
+	}
+	config := fs.String("config", "", "rules `file` in the format of goleaker config files")
+	url := fs.String("url", "", "capture from the net/http/pprof endpoint at `url`")
+	pid := fs.Int("pid", 0, "watch the process `pid` through its net/http/pprof endpoint")
+	interval := fs.Duration("interval", 2*time.Second, "how often to capture the goroutines")
+	history := fs.Int("history", 30, "number of captures the trends show")
+	auto := fs.Duration("auto-baseline", 0, "set the baseline once the count of goroutines has not changed for `window`")
+	fs.Parse(args)
+
+	var opts []goleaker.Option
+	if *config != "" {
+		c, err := goleaker.LoadConfig(*config)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, c.Option())
+	}
+	endpoint := *url
+	if *pid != 0 {
+		var err error
+		if endpoint, err = pprofEndpoint(*pid); err != nil {
+			return err
+		}
+	}
+	if endpoint == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	restore, err := rawTerminal()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	keys := make(chan byte)
+	go func() {
+		b := make([]byte, 1)
+		for {
+			if n, err := os.Stdin.Read(b); err != nil {
+				close(keys)
+				return
+			} else if n == 1 {
+				keys <- b[0]
+			}
+		}
+	}()
+
+	v := &view{source: endpoint, history: *history, auto: *auto, counts: map[string][]int{}}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	capture := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), *interval)
+		defer cancel()
+		gs, err := remote.Fetch(ctx, endpoint)
+		v.update(goleaker.Interesting(gs, opts...), err)
+	}
+	capture()
+	for {
+		v.draw()
+		select {
+		case <-ticker.C:
+			capture()
+		case <-interrupt:
+			return nil
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch k {
+			case 'q', 'Q':
+				return nil
+			case 's':
+				v.sort = (v.sort + 1) % len(sorts)
+			case 'b':
+				v.setBaseline()
+			case 'x':
+				v.baseline, v.baselineAt = nil, time.Time{}
+			case 'e':
+				v.export()
+			}
+		}
+	}
+}
+
+// view is the state of the tui.
+type view struct {
+	source  string
+	history int
+	auto    time.Duration
+	sort    int
+
+	gs   []*goleaker.Goroutine
+	err  error
+	at   time.Time
+	sigs []*tuiSig
+	// counts are the counts of every signature over the last captures,
+	// oldest first, zero where it had no goroutines.
+	counts map[string][]int
+
+	baseline   map[string]int
+	baselineAt time.Time
+	status     string
+	// total and stableSince are the count of goroutines and since when
+	// it has not changed, for the automatic baseline.
+	total       int
+	stableSince time.Time
+}
+
+type tuiSig struct {
+	id, state, top string
+	class          goleaker.LeakClass
+	n              int
+}
+
+func (v *view) update(gs []*goleaker.Goroutine, err error) {
+	v.err, v.at, v.status = err, time.Now(), ""
+	if err != nil && len(gs) == 0 {
+		return
+	}
+	v.gs = gs
+	bySig := map[string]*tuiSig{}
+	v.sigs = v.sigs[:0]
+	for _, g := range gs {
+		id := g.SignatureID()
+		s := bySig[id]
+		if s == nil {
+			s = &tuiSig{id: id, state: g.State, class: g.Class()}
+			if len(g.Frames) > 0 {
+				s.top = g.Frames[0].Func
+			}
+			bySig[id] = s
+			v.sigs = append(v.sigs, s)
+		}
+		s.n++
+	}
+	for id, c := range v.counts {
+		if bySig[id] == nil {
+			if c = v.push(c, 0); allZero(c) {
+				delete(v.counts, id)
+			} else {
+				v.counts[id] = c
+			}
+		}
+	}
+	for _, s := range v.sigs {
+		v.counts[s.id] = v.push(v.counts[s.id], s.n)
+	}
+	if len(gs) != v.total || v.stableSince.IsZero() {
+		v.total, v.stableSince = len(gs), v.at
+	}
+	if v.auto > 0 && v.baseline == nil && v.at.Sub(v.stableSince) >= v.auto {
+		v.setBaseline()
+		v.status = fmt.Sprintf("baseline set, %d goroutine(s) for %s", v.total, v.auto)
+	}
+}
+
+// push appends n to the counts c, keeping the last v.history.
+func (v *view) push(c []int, n int) []int {
+	c = append(c, n)
+	if len(c) > v.history {
+		c = c[len(c)-v.history:]
+	}
+	return c
+}
+
+func allZero(c []int) bool {
+	for _, n := range c {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *view) setBaseline() {
+	v.baseline = map[string]int{}
+	for _, s := range v.sigs {
+		v.baseline[s.id] = s.n
+	}
+	v.baselineAt = v.at
+}
+
+func (v *view) delta(s *tuiSig) int {
+	return s.n - v.baseline[s.id]
+}
+
+// growth is the change of the count of s over the trend.
+func (v *view) growth(s *tuiSig) int {
+	c := v.counts[s.id]
+	return c[len(c)-1] - c[0]
+}
+
+// export writes a report of the current goroutines, with their stacks, to
+// a file of the working directory.
+func (v *view) export() {
+	name := "goleaker-" + v.at.Format("20060102-150405") + ".txt"
+	f, err := os.Create(name)
+	if err == nil {
+		fmt.Fprintf(f, "%s at %s\n", v.source, v.at.Format(time.RFC3339))
+		err = report(f, v.gs, true)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		v.status = "export failed: " + err.Error()
+		return
+	}
+	v.status = "exported " + name
+}
+
+func (v *view) draw() {
+	sigs := append([]*tuiSig(nil), v.sigs...)
+	sort.SliceStable(sigs, func(i, j int) bool {
+		switch sorts[v.sort] {
+		case "delta":
+			return v.delta(sigs[i]) > v.delta(sigs[j])
+		case "growth":
+			return v.growth(sigs[i]) > v.growth(sigs[j])
+		case "sig":
+			return sigs[i].id < sigs[j].id
+		}
+		return sigs[i].n > sigs[j].n
+	})
+	rows, cols := terminalSize()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "goleaker tui  %s  %s\n", v.source, v.at.Format("15:04:05"))
+	fmt.Fprintf(&b, "%d goroutine(s), %d signature(s), sorted by %s", len(v.gs), len(sigs), sorts[v.sort])
+	switch {
+	case v.baseline != nil:
+		fmt.Fprintf(&b, ", baseline of %s", v.baselineAt.Format("15:04:05"))
+	case v.auto > 0:
+		fmt.Fprintf(&b, ", baseline once stable for %s", v.auto)
+	}
+	b.WriteString("\n")
+	switch {
+	case v.err != nil:
+		fmt.Fprintf(&b, "error: %s\n", v.err)
+	case v.status != "":
+		b.WriteString(v.status + "\n")
+	default:
+		b.WriteString("s sort  b baseline  x clear baseline  e export  q quit\n")
+	}
+	b.WriteString("\n")
+
+	header := strings.Count(b.String(), "\n") + 1
+	tw := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "count\tdelta\ttrend\tsig\tclass\tstate\ttop")
+	var grown []bool
+	for i, s := range sigs {
+		if i >= rows-6 {
+			break
+		}
+		grown = append(grown, v.baseline != nil && v.delta(s) > 0)
+		delta := ""
+		if v.baseline != nil {
+			delta = fmt.Sprintf("%+d", v.delta(s))
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", s.n, delta, sparkline(v.counts[s.id]), s.id, s.class, s.state, s.top)
+	}
+	tw.Flush()
+
+	var out bytes.Buffer
+	// home, clear and hide the cursor
+	out.WriteString("\x1b[H\x1b[2J\x1b[?25l")
+	for i, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		line = truncate(line, cols)
+		if row := i - header; row >= 0 && row < len(grown) && grown[row] {
+			// bold red
+			line = "\x1b[1;31m" + line + "\x1b[0m"
+		}
+		out.WriteString(line + "\r\n")
+	}
+	os.Stdout.Write(out.Bytes())
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws counts scaled between their minimum and maximum.
+func sparkline(counts []int) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	lo, hi := counts[0], counts[0]
+	for _, n := range counts {
+		lo, hi = min(lo, n), max(hi, n)
+	}
+	var b strings.Builder
+	for _, n := range counts {
+		i := 0
+		if hi > lo {
+			i = (n - lo) * (len(sparks) - 1) / (hi - lo)
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+func truncate(line string, cols int) string {
+	if utf8.RuneCountInString(line) <= cols {
+		return line
+	}
+	return string([]rune(line)[:cols])
+}
+
+// rawTerminal puts the terminal of stdin in cbreak mode without echo, so
+// keys are read as they are pressed, and returns the function restoring
+// it. It uses stty, which avoids the termios ioctls differing across
+// systems.
+func rawTerminal() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("tui needs a terminal: %w", err)
+	}
+	if _, err := stty("cbreak", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() {
+		stty(strings.TrimSpace(saved))
+		// show the cursor again
+		os.Stdout.WriteString("\x1b[?25h\n")
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// terminalSize returns the rows and columns of the terminal, or 24x80.
+func terminalSize() (int, int) {
+	out, err := stty("size")
+	if f := strings.Fields(out); err == nil && len(f) == 2 {
+		rows, err1 := strconv.Atoi(f[0])
+		cols, err2 := strconv.Atoi(f[1])
+		if err1 == nil && err2 == nil && rows > 0 && cols > 0 {
+			return rows, cols
+		}
+	}
+	return 24, 80
+}
@@ -0,0 +1,13 @@
+// Command goleakvet statically flags code likely to leak goroutines, see
+// package analysis for the checks. Run it on packages directly or as a go
+// vet tool:
+//
+//	goleakvet ./...
+//	go vet -vettool=$(which goleakvet) ./...
+package main
+
+import "github.com/rfyiamcool/goleaker/analysis"
+
+func main() {
+	analysis.Main()
+}
@@ -0,0 +1,366 @@
+package goleaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigEnv names the environment variable overriding config discovery:
+// it holds the path of the config file to use, or "off" to disable it.
+const ConfigEnv = "GOLEAKER_CONFIG"
+
+// configFiles are the names FindConfig looks for, in order.
+var configFiles = []string{"goleaker.yaml", "goleaker.yml", "goleaker.json"}
+
+// Config is a set of rules, usually loaded from a goleaker.yaml file at the
+// repository root so policy is managed in one place:
+//
+//	ignore:
+//	  - package: go.opencensus.io/...
+//	  - top_func: time.Sleep
+//	    min_age: 5m
+//	  - created_by: example.com/queue.(*Consumer).run
+//	    owner: jane
+//	    ticket: JIRA-123
+//	    expires: 2024-06-30
+//	require:
+//	  - created_by: example.com/db.(*Pool).start
+//	warn:
+//	  - package: example.com/legacy/...
+//	budget:
+//	  - any_frame: example.com/cache.(*Cache).janitor
+//	    max: 1
+//	strict: true
+//
+// Every check applies the config discovered by FindConfig from the working
+// directory before its own options.
+type Config struct {
+	// Ignore rules ignore the goroutines they match.
+	Ignore []Rule `json:"ignore"`
+	// Require rules match goroutines that must be gone regardless of any
+	// ignore rule.
+	Require []Rule `json:"require"`
+	// Warn rules make the leaks they match warnings.
+	Warn []Rule `json:"warn"`
+	// Budget rules tolerate up to Max leaked goroutines each.
+	Budget []Budget `json:"budget"`
+	// Strict makes every check Strict.
+	Strict bool `json:"strict"`
+
+	opt Option
+}
+
+// UnmarshalJSON accepts Strict as a boolean or, as YAML configs have it, a
+// string holding one.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type config Config
+	var v struct {
+		config
+		Strict json.RawMessage `json:"strict"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	*c = Config(v.config)
+	if v.Strict == nil {
+		return nil
+	}
+	strict, err := strconv.ParseBool(strings.Trim(string(v.Strict), `"`))
+	if err != nil {
+		return fmt.Errorf("strict %s is not a boolean", v.Strict)
+	}
+	c.Strict = strict
+	return nil
+}
+
+// Rule describes goroutines; a goroutine matches when every field set
+// matches, see the matchers of the same name.
+type Rule struct {
+	TopFunc   string `json:"top_func,omitempty"`
+	AnyFrame  string `json:"any_frame,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+	// Package is an import path pattern for the creation frame, as for
+	// IgnorePackages.
+	Package string `json:"package,omitempty"`
+	State   string `json:"state,omitempty"`
+	// Class is a LeakClass such as "BLOCKED_RECV".
+	Class string `json:"class,omitempty"`
+	// Signature is a possibly abbreviated SignatureID.
+	Signature string `json:"signature,omitempty"`
+	// MinAge is a duration such as "5m".
+	MinAge string `json:"min_age,omitempty"`
+
+	// Owner, Ticket and Expires turn an ignore rule into a Suppression;
+	// Expires is a date such as "2024-06-30".
+	Owner   string `json:"owner,omitempty"`
+	Ticket  string `json:"ticket,omitempty"`
+	Expires string `json:"expires,omitempty"`
+}
+
+// Budget tolerates up to Max leaked goroutines matching its rule.
+type Budget struct {
+	Rule
+	Max int `json:"max"`
+}
+
+// UnmarshalJSON accepts Max as a number or, as YAML configs have it, a
+// string holding one.
+func (b *Budget) UnmarshalJSON(data []byte) error {
+	type budget Budget
+	var v struct {
+		budget
+		Max json.RawMessage `json:"max"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	*b = Budget(v.budget)
+	if v.Max == nil {
+		return nil
+	}
+	max, err := strconv.Atoi(strings.Trim(string(v.Max), `"`))
+	if err != nil {
+		return fmt.Errorf("budget max %s is not an integer", v.Max)
+	}
+	b.Max = max
+	return nil
+}
+
+// Matcher compiles the rule into a Matcher.
+func (r Rule) Matcher() (Matcher, error) {
+	var ms []Matcher
+	if r.TopFunc != "" {
+		ms = append(ms, TopFunc(r.TopFunc))
+	}
+	if r.AnyFrame != "" {
+		ms = append(ms, AnyFrame(r.AnyFrame))
+	}
+	if r.CreatedBy != "" {
+		ms = append(ms, CreatedBy(r.CreatedBy))
+	}
+	if r.Package != "" {
+		ms = append(ms, createdInPackage(r.Package))
+	}
+	if r.State != "" {
+		ms = append(ms, State(r.State))
+	}
+	if r.Class != "" {
+		ms = append(ms, Class(LeakClass(r.Class)))
+	}
+	if r.Signature != "" {
+		ms = append(ms, SignatureID(r.Signature))
+	}
+	if r.MinAge != "" {
+		d, err := time.ParseDuration(r.MinAge)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, MinAge(d))
+	}
+	if len(ms) == 0 {
+		return nil, errors.New("empty rule matches every goroutine")
+	}
+	return And(ms...), nil
+}
+
+// WithBudget tolerates up to max leaked goroutines matched by m; a check
+// only reports them once there are more.
+func WithBudget(m Matcher, max int) Option {
+	return func(o *options) {
+		o.budgets = append(o.budgets, budget{m: m, max: max})
+	}
+}
+
+type budget struct {
+	m   Matcher
+	max int
+}
+
+// withinBudget drops the leaked goroutines of every budget which is not
+// exceeded.
+func (o *options) withinBudget(leaked []*Goroutine) []*Goroutine {
+	for _, b := range o.budgets {
+		n := 0
+		for _, g := range leaked {
+			if b.m(g) {
+				n++
+			}
+		}
+		if n == 0 || n > b.max {
+			continue
+		}
+		kept := make([]*Goroutine, 0, len(leaked)-n)
+		for _, g := range leaked {
+			if !b.m(g) {
+				kept = append(kept, g)
+			}
+		}
+		leaked = kept
+	}
+	return leaked
+}
+
+// LoadConfig reads a config file, as JSON if its name ends in ".json" and
+// as YAML otherwise.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseConfig(data, filepath.Ext(path) == ".json")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+// ParseConfig parses a config in JSON or YAML format. Unknown fields are
+// an error, so typos do not silently disable a rule.
+func ParseConfig(data []byte, isJSON bool) (*Config, error) {
+	if !isJSON {
+		v, err := parseYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	c := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, err
+	}
+	if err := c.compile(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) compile() error {
+	var opts []Option
+	for i, r := range c.Ignore {
+		m, err := r.Matcher()
+		if err != nil {
+			return fmt.Errorf("ignore rule %d: %s", i, err)
+		}
+		if r.Owner == "" && r.Ticket == "" && r.Expires == "" {
+			opts = append(opts, Ignore(m))
+			continue
+		}
+		s := Suppression{Owner: r.Owner, Ticket: r.Ticket}
+		if r.Expires != "" {
+			if s.Expires, err = time.Parse("2006-01-02", r.Expires); err != nil {
+				return fmt.Errorf("ignore rule %d: %s", i, err)
+			}
+		}
+		opts = append(opts, Suppress(s, m))
+	}
+	for i, r := range c.Require {
+		m, err := r.Matcher()
+		if err != nil {
+			return fmt.Errorf("require rule %d: %s", i, err)
+		}
+		opts = append(opts, RequireGone(m))
+	}
+	for i, r := range c.Warn {
+		m, err := r.Matcher()
+		if err != nil {
+			return fmt.Errorf("warn rule %d: %s", i, err)
+		}
+		opts = append(opts, Warn(m))
+	}
+	for i, b := range c.Budget {
+		m, err := b.Matcher()
+		if err != nil {
+			return fmt.Errorf("budget rule %d: %s", i, err)
+		}
+		opts = append(opts, WithBudget(m, b.Max))
+	}
+	if c.Strict {
+		opts = append(opts, Strict())
+	}
+	c.opt = func(o *options) {
+		for _, opt := range opts {
+			opt(o)
+		}
+	}
+	return nil
+}
+
+// Option returns the option applying every rule of the config.
+func (c *Config) Option() Option {
+	if c.opt == nil {
+		if err := c.compile(); err != nil {
+			return func(o *options) { o.configErr = err }
+		}
+	}
+	return c.opt
+}
+
+// FindConfig looks for a config file in dir and its parents, stopping at
+// the repository root, and returns its path.
+func FindConfig(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		for _, name := range configFiles {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path, true
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+var (
+	discoverOnce sync.Once
+	discovered   Option
+)
+
+// discoveredConfig returns the option of the config named by ConfigEnv or
+// found by FindConfig from the working directory, or nil.
+func discoveredConfig() Option {
+	discoverOnce.Do(func() {
+		path := os.Getenv(ConfigEnv)
+		if path == "off" {
+			return
+		}
+		if path == "" {
+			var ok bool
+			if path, ok = FindConfig("."); !ok {
+				return
+			}
+		}
+		c, err := LoadConfig(path)
+		if err != nil {
+			discovered = func(o *options) { o.configErr = err }
+			return
+		}
+		discovered = c.Option()
+	})
+	return discovered
+}
@@ -0,0 +1,33 @@
+package goleaker
+
+import "runtime"
+
+// WithConfirmations makes a check recapture the goroutines n times in
+// quick succession, yielding the processor before each, before it reports
+// leaks. Only goroutines leaked in every capture are reported, so the ones
+// caught on their way out are not.
+func WithConfirmations(n int) Option {
+	return func(o *options) {
+		o.confirmations = n
+	}
+}
+
+// confirm returns the goroutines of leaked that are still leaked in every
+// one of the confirmation captures taken with recapture.
+func (o *options) confirm(leaked []*Goroutine, recapture func() []*Goroutine) []*Goroutine {
+	for i := 0; i < o.confirmations && len(leaked) > 0; i++ {
+		runtime.Gosched()
+		still := map[uint64]bool{}
+		for _, g := range recapture() {
+			still[g.ID] = true
+		}
+		confirmed := leaked[:0:0]
+		for _, g := range leaked {
+			if still[g.ID] {
+				confirmed = append(confirmed, g)
+			}
+		}
+		leaked = confirmed
+	}
+	return leaked
+}
@@ -0,0 +1,42 @@
+package goleaker
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"time"
+)
+
+// CreatedLabel is the pprof label holding the creation time of a goroutine
+// in Unix nanoseconds, as set by Go. A check never reports goroutines
+// labeled with a time before it began, and reports give the precise age
+// of the others.
+const CreatedLabel = "goleaker.created"
+
+// Go runs fn in a new goroutine labeled with its creation time, keeping
+// the pprof labels of ctx. See Goroutine.Labels for when the runtime
+// prints the label. Stack dumps show such goroutines as created by Go.
+func Go(ctx context.Context, fn func(ctx context.Context)) {
+	created := strconv.FormatInt(time.Now().UnixNano(), 10)
+	pprof.Do(ctx, pprof.Labels(CreatedLabel, created), func(ctx context.Context) {
+		go fn(ctx)
+	})
+}
+
+// Created returns the creation time of g from its CreatedLabel.
+func (g *Goroutine) Created() (time.Time, bool) {
+	ns, err := strconv.ParseInt(g.Labels[CreatedLabel], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
+// Age returns how long ago g was created according to its CreatedLabel.
+func (g *Goroutine) Age() (time.Duration, bool) {
+	created, ok := g.Created()
+	if !ok {
+		return 0, false
+	}
+	return time.Since(created), true
+}
@@ -0,0 +1,97 @@
+package goleaker
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ContextLabel is the pprof label identifying the context a goroutine was
+// started with, as set by WithContextTracking.
+const ContextLabel = "goleaker.context"
+
+var contextIDs atomic.Uint64
+
+type trackingKey struct{}
+
+// WithContextTracking returns a copy of ctx carrying a ContextLabel, which
+// goroutines started with Go, or under pprof.SetGoroutineLabels, inherit.
+// CheckCanceled then finds the goroutines that outlive ctx. It finds them
+// by their label in stack dumps, which the runtime only prints with
+// GODEBUG=tracebacklabels=1, the default for main modules declaring
+// go 1.27 or later; without it CheckCanceled fails the test.
+func WithContextTracking(ctx context.Context) context.Context {
+	id := strconv.FormatUint(contextIDs.Add(1), 10)
+	ctx = context.WithValue(ctx, trackingKey{}, id)
+	return pprof.WithLabels(ctx, pprof.Labels(ContextLabel, id))
+}
+
+// CheckCanceled returns a function to be run at the end of tests which,
+// once the tracked ctx was canceled and its grace period set by
+// WithTimeout elapsed, reports the goroutines started with ctx that are
+// still running, typically blocked selecting on its Done channel.
+func CheckCanceled(t ErrorReporter, ctx context.Context, opts ...Option) func() {
+	o := newOptions(opts)
+	t = o.reporter(t)
+	o.testName = testName(t)
+	id, _ := ctx.Value(trackingKey{}).(string)
+	var canceled atomic.Int64
+	stop := context.AfterFunc(ctx, func() {
+		canceled.Store(time.Now().UnixNano())
+	})
+	return func() {
+		stop()
+		if id == "" {
+			t.Errorf("leaktest: context is not tracked, see WithContextTracking")
+			return
+		}
+		if !labelsVisible() {
+			t.Errorf("leaktest: goroutine labels not visible in stack dumps, set GODEBUG=tracebacklabels=1")
+			return
+		}
+		if ctx.Err() == nil {
+			return
+		}
+		// AfterFunc may still be about to run
+		at := time.Now()
+		if ns := canceled.Load(); ns != 0 {
+			at = time.Unix(0, ns)
+		}
+		deadline := at.Add(o.timeout)
+		for {
+			var alive []*Goroutine
+			gs := interestingGoroutines(t, o)
+			for _, g := range gs {
+				if g.Labels[ContextLabel] == id {
+					alive = append(alive, g)
+				}
+			}
+			if len(alive) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				reportGoroutines(t, o, fmt.Sprintf("%d goroutine(s) started with the context still running %v after it was canceled",
+					len(alive), time.Since(at).Round(time.Millisecond)), alive, len(gs))
+				return
+			}
+			time.Sleep(o.pollInterval())
+		}
+	}
+}
+
+// labelsVisible reports whether stack dumps show pprof labels, probing the
+// header of a labeled goroutine, as GODEBUG may change while running.
+func labelsVisible() bool {
+	visible := make(chan bool)
+	go pprof.Do(context.Background(), pprof.Labels(ContextLabel, "probe"), func(context.Context) {
+		buf := make([]byte, 1024)
+		header, _, _ := strings.Cut(string(buf[:runtime.Stack(buf, false)]), "\n")
+		visible <- headerLabels(header)[ContextLabel] == "probe"
+	})
+	return <-visible
+}
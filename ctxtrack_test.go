@@ -0,0 +1,81 @@
+package goleaker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reporter records the errors and logs of a check instead of failing the
+// test.
+type reporter struct {
+	mu   sync.Mutex
+	errs []string
+	logs []string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *reporter) Logf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func (r *reporter) errors() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.errs, "\n")
+}
+
+func TestCheckCanceled(t *testing.T) {
+	t.Setenv("GODEBUG", "tracebacklabels=1")
+	tests := []struct {
+		name     string
+		exits    bool
+		wantErrs string
+	}{
+		{"leaked", false, "1 goroutine(s) started with the context still running"},
+		{"exited", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(WithContextTracking(context.Background()))
+			r := &reporter{}
+			check := CheckCanceled(r, ctx, WithTimeout(50*time.Millisecond))
+			stop := make(chan struct{})
+			defer close(stop)
+			Go(ctx, func(ctx context.Context) {
+				if tt.exits {
+					<-ctx.Done()
+					return
+				}
+				<-stop
+			})
+			cancel()
+			check()
+			if got := r.errors(); tt.wantErrs == "" && got != "" || !strings.Contains(got, tt.wantErrs) {
+				t.Errorf("CheckCanceled reported %q, want %q", got, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestCheckCanceledWithoutLabels(t *testing.T) {
+	t.Setenv("GODEBUG", "tracebacklabels=0")
+	ctx, cancel := context.WithCancel(WithContextTracking(context.Background()))
+	r := &reporter{}
+	check := CheckCanceled(r, ctx, WithTimeout(50*time.Millisecond))
+	cancel()
+	check()
+	if got, want := r.errors(), "set GODEBUG=tracebacklabels=1"; !strings.Contains(got, want) {
+		t.Errorf("CheckCanceled reported %q, want it to contain %q", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package goleaker
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// WithRerunDedup remembers, per test and signature, how often a leak was
+// reported, so a test rerun by go test -count=N or a retrying runner
+// reports a leak it already reported with a one line "previously reported
+// (xN)" instead of another full stack. The check still fails. With an
+// empty path the reports are remembered by the test binary, which covers
+// -count; otherwise they are kept in the JSON file at path, which should
+// live as long as a CI run, e.g. under its temporary directory, to cover
+// retries in new processes.
+func WithRerunDedup(path string) Option {
+	return func(o *options) {
+		o.dedup = true
+		o.dedupFile = path
+	}
+}
+
+// reportedLeaks maps tests to the number of times each signature leaked.
+type reportedLeaks map[string]map[string]int
+
+var (
+	dedupMu sync.Mutex
+	// reported are the leaks remembered by the test binary.
+	reported = reportedLeaks{}
+)
+
+// recordReported records the leaks about to be reported and returns how
+// often each of them was reported before, by goroutine id.
+func (o *options) recordReported(t ErrorReporter, leaked []*Goroutine) map[uint64]int {
+	if !o.dedup || len(leaked) == 0 {
+		return nil
+	}
+	dedupMu.Lock()
+	defer dedupMu.Unlock()
+	h := reported
+	if o.dedupFile != "" {
+		h = reportedLeaks{}
+		data, err := os.ReadFile(o.dedupFile)
+		if err == nil {
+			err = json.Unmarshal(data, &h)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("leaktest: rerun dedup: %s", err)
+			return nil
+		}
+	}
+	sigs := h[o.testName]
+	if sigs == nil {
+		sigs = map[string]int{}
+		h[o.testName] = sigs
+	}
+	repeats := map[uint64]int{}
+	for _, gr := range groupGoroutines(leaked) {
+		if n := sigs[gr.id]; n > 0 {
+			for _, g := range gr.goroutines {
+				repeats[g.ID] = n
+			}
+		}
+		sigs[gr.id]++
+	}
+	if o.dedupFile != "" {
+		data, err := json.MarshalIndent(h, "", "  ")
+		if err == nil {
+			err = os.WriteFile(o.dedupFile, data, 0o644)
+		}
+		if err != nil {
+			t.Errorf("leaktest: rerun dedup: %s", err)
+		}
+	}
+	return repeats
+}
@@ -0,0 +1,87 @@
+package goleaker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DryRunEnv enables WithDryRun for every check when set to a true value,
+// to observe the tests of a whole repository without changing their code.
+const DryRunEnv = "GOLEAKER_DRY_RUN"
+
+// WithDryRun makes checks observe only, to roll them out before enforcing
+// them. Whatever a check finds, leaked goroutines as well as child
+// processes, temporary files or unreleased resources, goes to the sinks of
+// WithSink, or the standard logger without any, as a MonitorReport: no
+// check fails a test, returns an error or makes the process exit non-zero.
+// Checks built outside of goleaker honor it by reporting through Reporter
+// or ReportFinding.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// dryRunFromEnv applies DryRunEnv.
+func dryRunFromEnv(o *options) {
+	if on, _ := strconv.ParseBool(os.Getenv(DryRunEnv)); on {
+		o.dryRun = true
+	}
+}
+
+// Reporter returns the reporter through which the checks configured by
+// opts report to t: t itself, or in WithDryRun mode one handing every
+// error to the sinks instead.
+func Reporter(t ErrorReporter, opts ...Option) ErrorReporter {
+	return newOptions(opts).reporter(t)
+}
+
+// reporter returns the reporter the checks of o report to t through.
+func (o *options) reporter(t ErrorReporter) ErrorReporter {
+	if o.dryRun {
+		return dryRunReporter{ErrorReporter: t, o: o}
+	}
+	return t
+}
+
+// dryRunReporter hands errors to the sinks of o as findings.
+type dryRunReporter struct {
+	ErrorReporter
+	o *options
+}
+
+func (r dryRunReporter) Errorf(format string, args ...interface{}) {
+	name := testName(r.ErrorReporter)
+	msg := strings.TrimPrefix(fmt.Sprintf(format, args...), "leaktest: ")
+	if name != "" {
+		msg = strings.TrimPrefix(msg, name+": ")
+	}
+	r.o.sink(MonitorReport{Test: name, Findings: []Finding{{Message: msg}}})
+}
+
+func (r dryRunReporter) Logf(format string, args ...interface{}) {
+	logf(r.ErrorReporter, format, args...)
+}
+
+func (r dryRunReporter) Failed() bool {
+	return failed(r.ErrorReporter)
+}
+
+func (r dryRunReporter) Name() string {
+	return testName(r.ErrorReporter)
+}
+
+// sink hands r, found in dry run mode, to the sinks.
+func (o *options) sink(r MonitorReport) {
+	r.Time = time.Now()
+	sinks := o.sinks
+	if len(sinks) == 0 {
+		sinks = []Sink{logSink{}}
+	}
+	for _, s := range sinks {
+		s.Report(r)
+	}
+}
@@ -0,0 +1,130 @@
+package goleaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrLeak matches every *LeakError with errors.Is, for callers that only
+// need to know whether goroutines leaked.
+var ErrLeak = errors.New("goleaker: goroutines leaked")
+
+// Leak is a goroutine found leaked by Find, Verify or DrainAndVerify.
+type Leak struct {
+	Goroutine *Goroutine
+	Signature string
+	Class     LeakClass
+	// Owner is the likely owner set by WithOwners or WithCodeowners.
+	Owner string
+	// Blame is the last change of the line which started the goroutine,
+	// set by WithBlame.
+	Blame *Blame
+}
+
+func newLeaks(o *options, gs []*Goroutine) []Leak {
+	leaks := make([]Leak, len(gs))
+	for i, g := range gs {
+		leaks[i] = Leak{Goroutine: g, Signature: g.SignatureID(), Class: o.class(g), Owner: o.owner(g), Blame: o.blameOf(g)}
+	}
+	return leaks
+}
+
+// LeakError is returned by Find, Verify and DrainAndVerify when goroutines
+// leaked. Its message is the report a check would have failed the test
+// with.
+type LeakError struct {
+	leaks   []Leak
+	reports []string
+	// cause is why the goroutines were given up on, if known.
+	cause error
+}
+
+// Leaks returns the leaked goroutines, ordered by id.
+func (e *LeakError) Leaks() []Leak {
+	return e.leaks
+}
+
+func (e *LeakError) Error() string {
+	var b strings.Builder
+	b.WriteString("goleaker: ")
+	for i, r := range e.reports {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(strings.TrimPrefix(r, "leaktest: "))
+	}
+	return b.String()
+}
+
+// Is reports whether target is ErrLeak.
+func (e *LeakError) Is(target error) bool {
+	return target == ErrLeak
+}
+
+// Unwrap returns why the goroutines were given up on, e.g. the error of
+// the context of DrainAndVerify, or nil.
+func (e *LeakError) Unwrap() error {
+	return e.cause
+}
+
+// Find returns a *LeakError listing the goroutines running besides the
+// calling one and those the options ignore, or nil when there are none.
+// Like Check, it looks once unless given WithTimeout. It suits code with
+// no testing.TB at hand, e.g. a shutdown path asserting it stopped every
+// worker.
+func Find(opts ...Option) error {
+	opts = append([]Option{WithTimeout(0), IgnoreGoroutineIDs(CurrentGoroutineID())}, opts...)
+	return verify(context.Background(), nil, append(opts, withoutBaseline()))
+}
+
+// Verify runs fn and returns a *LeakError listing the goroutines it
+// started that are still running, or nil when there are none. Like
+// Check, it looks once unless given WithTimeout.
+func Verify(fn func(), opts ...Option) error {
+	opts = append([]Option{WithTimeout(0)}, opts...)
+	return verify(context.Background(), fn, opts)
+}
+
+// verify runs a check around fn, collecting what it reports into an
+// error instead of failing a test.
+func verify(ctx context.Context, fn func(), opts []Option) error {
+	c := &collectingReporter{}
+	var (
+		leaked []*Goroutine
+		// o is the options of the check, which classified the leaks
+		o *options
+	)
+	check := CheckContext(ctx, c, append(opts[:len(opts):len(opts)], onLeak(func(gs []*Goroutine) {
+		leaked = gs
+	}), func(co *options) { o = co })...)
+	if fn != nil {
+		fn()
+	}
+	check()
+	if len(leaked) > 0 {
+		return &LeakError{leaks: newLeaks(o, leaked), reports: c.msgs}
+	}
+	if len(c.msgs) > 0 {
+		return errors.New("goleaker: " + strings.TrimPrefix(strings.Join(c.msgs, "\n"), "leaktest: "))
+	}
+	return nil
+}
+
+// withoutBaseline makes a check consider every goroutine it captures,
+// rather than those started since it began.
+func withoutBaseline() Option {
+	return func(o *options) {
+		o.noBaseline = true
+	}
+}
+
+// collectingReporter keeps the errors reported to it.
+type collectingReporter struct {
+	msgs []string
+}
+
+func (c *collectingReporter) Errorf(format string, args ...interface{}) {
+	c.msgs = append(c.msgs, fmt.Sprintf(format, args...))
+}
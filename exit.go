@@ -0,0 +1,196 @@
+package goleaker
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// DeferGracePeriod is how long the function returned by Defer waits for
+// goroutines to exit.
+var DeferGracePeriod = time.Second
+
+// ExitHook exits the process: with code 1 for the function returned by
+// Defer when it found leaks, and with the exit code of Exit. Set it to
+// nil to only print leaks.
+var ExitHook = os.Exit
+
+// Defer snapshots the currently-running goroutines and returns a function
+// to defer in main or an Example, so sample programs and CLIs check
+// themselves for leaks on exit:
+//
+//	func main() {
+//		defer goleaker.Defer()()
+//		...
+//	}
+//
+// Leaks are printed to stderr, then ExitHook is called. Deferred first, the
+// function runs after every other deferred call of main.
+func Defer(opts ...Option) func() {
+	c := &countingReporter{ErrorReporter: stderrReporter{}}
+	fn := CheckTimeout(c, scaled(DeferGracePeriod), opts...)
+	return func() {
+		fn()
+		if c.n > 0 && ExitHook != nil {
+			ExitHook(1)
+		}
+	}
+}
+
+// stderrReporter prints errors to stderr.
+type stderrReporter struct{}
+
+func (stderrReporter) Errorf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// writerReporter prints errors to w.
+type writerReporter struct{ w io.Writer }
+
+func (r writerReporter) Errorf(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, format+"\n", args...)
+}
+
+// WithExitReport makes InstallExitCheck write its report to path instead
+// of stderr. The file is only created when there are leaks.
+func WithExitReport(path string) Option {
+	return func(o *options) {
+		o.exitReport = path
+	}
+}
+
+// WithExitSignals makes InstallExitCheck also run its check on SIGINT or
+// SIGTERM, an interrupt note on Plan 9, for programs not handling them
+// themselves. The signal is raised again once the check ran, with
+// goleaker no longer listening for it, so the process dies of it as it
+// would have. A handler of the application would get it a second time
+// instead, see WithSharedExitSignals.
+func WithExitSignals() Option {
+	return func(o *options) {
+		o.exitSignals = true
+	}
+}
+
+// WithSharedExitSignals is WithExitSignals for applications handling
+// SIGINT or SIGTERM themselves, which os/signal cannot tell goleaker
+// about: the check runs on the signal, but the signal is not raised
+// again and the exit is left to the application. Its shutdown may call
+// Exit, which does not run the check a second time.
+func WithSharedExitSignals() Option {
+	return func(o *options) {
+		o.exitSignals = true
+		o.sharedSignals = true
+	}
+}
+
+var exitCheck struct {
+	mu    sync.Mutex
+	check func() bool
+}
+
+// exitSignalsOnce starts the one goroutine watching for exit signals, as
+// set by the first InstallExitCheck asking for it.
+var exitSignalsOnce sync.Once
+
+// InstallExitCheck snapshots the currently-running goroutines and checks
+// for leaks before the process exits through Exit, or with
+// WithExitSignals or WithSharedExitSignals because of SIGINT or SIGTERM,
+// for CLIs and batch jobs whose main has many ways out. Leaks are written
+// to stderr or the path set with WithExitReport, and turn a zero exit
+// code of Exit into 1. Only the last installed check runs.
+func InstallExitCheck(opts ...Option) {
+	// the signal goroutine is not a leak
+	opts = append([]Option{Ignore(funcPrefix(selfPackage + ".watchExitSignals"))}, opts...)
+	o := newOptions(opts)
+	if o.exitSignals {
+		exitSignalsOnce.Do(func() {
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, exitSignals...)
+			go watchExitSignals(sigs, o.sharedSignals)
+		})
+	}
+	out := &exitReport{path: o.exitReport}
+	c := &countingReporter{ErrorReporter: out}
+	fn := CheckTimeout(c, scaled(DeferGracePeriod), opts...)
+
+	exitCheck.mu.Lock()
+	exitCheck.check = func() bool {
+		fn()
+		out.close()
+		return c.n > 0
+	}
+	exitCheck.mu.Unlock()
+}
+
+// watchExitSignals runs the installed check on the first signal of sigs,
+// then stops listening and, unless the signals are shared with the
+// application, raises the signal again. Where it cannot be raised, e.g.
+// os.Interrupt on Windows, the process exits as a shell would report it
+// killed by the signal.
+func watchExitSignals(sigs chan os.Signal, shared bool) {
+	sig := <-sigs
+	signal.Stop(sigs)
+	if check := takeExitCheck(); check != nil {
+		check()
+	}
+	if shared {
+		return
+	}
+	if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(sig) == nil {
+		return
+	}
+	os.Exit(signalExitCode(sig))
+}
+
+// takeExitCheck returns the installed check, if any, and uninstalls it.
+func takeExitCheck() func() bool {
+	exitCheck.mu.Lock()
+	defer exitCheck.mu.Unlock()
+	check := exitCheck.check
+	exitCheck.check = nil
+	return check
+}
+
+// Exit runs the check installed by InstallExitCheck, if any, and exits
+// the process through ExitHook with code, or 1 if the code was zero and
+// there were leaks. It returns when ExitHook is nil.
+func Exit(code int) {
+	if check := takeExitCheck(); check != nil && check() && code == 0 {
+		code = 1
+	}
+	if ExitHook != nil {
+		ExitHook(code)
+	}
+}
+
+// exitReport writes errors to stderr, or to a file created on the first
+// error if path is set.
+type exitReport struct {
+	path string
+	f    *os.File
+	r    ErrorReporter
+}
+
+func (e *exitReport) Errorf(format string, args ...interface{}) {
+	if e.r == nil {
+		e.r = stderrReporter{}
+		if e.path != "" {
+			f, err := os.Create(e.path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "goleaker: %s\n", err)
+			} else {
+				e.f, e.r = f, writerReporter{f}
+			}
+		}
+	}
+	e.r.Errorf(format, args...)
+}
+
+func (e *exitReport) close() {
+	if e.f != nil {
+		e.f.Close()
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !plan9
+
+package goleaker
+
+import (
+	"os"
+	"syscall"
+)
+
+// exitSignals are the signals InstallExitCheck runs its check on with
+// WithExitSignals.
+var exitSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// signalExitCode is the exit code of a process killed by sig, as shells
+// report it.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
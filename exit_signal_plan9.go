@@ -0,0 +1,13 @@
+package goleaker
+
+import "os"
+
+// exitSignals are the notes InstallExitCheck runs its check on with
+// WithExitSignals.
+var exitSignals = []os.Signal{os.Interrupt}
+
+// signalExitCode is the exit code of a process killed by sig. Plan 9 has
+// no numbered signals.
+func signalExitCode(sig os.Signal) int {
+	return 1
+}
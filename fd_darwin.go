@@ -0,0 +1,43 @@
+package goleaker
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// proc_pidinfo is called through libSystem as package syscall calls libc,
+// so the count needs no cgo.
+//
+//go:cgo_import_dynamic libc_proc_pidinfo proc_pidinfo "/usr/lib/libSystem.B.dylib"
+
+var libc_proc_pidinfo_trampoline_addr uintptr
+
+//go:linkname syscall_syscall6 syscall.syscall6
+func syscall_syscall6(fn, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, err syscall.Errno)
+
+const (
+	// procPIDListFDs is PROC_PIDLISTFDS of <sys/proc_info.h>.
+	procPIDListFDs = 1
+	// procFDInfoSize is the size of a struct proc_fdinfo.
+	procFDInfoSize = 8
+)
+
+// countFDs lists the file descriptors of the process with proc_pidinfo.
+func countFDs() (int, bool) {
+	pid := uintptr(syscall.Getpid())
+	// without a buffer, proc_pidinfo returns the size it needs
+	size, _, _ := syscall_syscall6(libc_proc_pidinfo_trampoline_addr, pid, procPIDListFDs, 0, 0, 0, 0)
+	if int32(size) <= 0 {
+		return 0, false
+	}
+	// leave room for descriptors opened in between
+	buf := make([]byte, int(int32(size))+16*procFDInfoSize)
+	n, _, _ := syscall_syscall6(libc_proc_pidinfo_trampoline_addr, pid, procPIDListFDs, 0,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
+	runtime.KeepAlive(buf)
+	if int32(n) <= 0 {
+		return 0, false
+	}
+	return int(int32(n)) / procFDInfoSize, true
+}
@@ -0,0 +1,43 @@
+package goleaker
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestCountFDsDup(t *testing.T) {
+	before, ok := countFDs()
+	if !ok {
+		t.Fatal("countFDs is not supported")
+	}
+	fd, err := syscall.Dup(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	if n, _ := countFDs(); n != before+1 {
+		t.Errorf("countFDs = %d after dup, want %d", n, before+1)
+	}
+}
+
+// The fdesc file system lists the same descriptors, and the one open to
+// read it.
+func TestCountFDsMatchesDevFD(t *testing.T) {
+	f, err := os.Open("/dev/fd")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+	n, ok := countFDs()
+	if !ok {
+		t.Fatal("countFDs is not supported")
+	}
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(names) {
+		t.Errorf("countFDs = %d, /dev/fd lists %d", n, len(names))
+	}
+}
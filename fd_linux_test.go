@@ -0,0 +1,21 @@
+package goleaker
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestCountFDsDup(t *testing.T) {
+	before, ok := countFDs()
+	if !ok {
+		t.Fatal("countFDs is not supported")
+	}
+	fd, err := syscall.Dup(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	if n, _ := countFDs(); n != before+1 {
+		t.Errorf("countFDs = %d after dup, want %d", n, before+1)
+	}
+}
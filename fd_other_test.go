@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package goleaker
+
+import "testing"
+
+func TestCountFDsUnsupported(t *testing.T) {
+	if n, ok := countFDs(); ok {
+		t.Errorf("countFDs = %d, true, want no count on this platform", n)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build linux || darwin || windows
+
+package goleaker
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCountFDsFollowsOpenFiles(t *testing.T) {
+	before, ok := countFDs()
+	if !ok {
+		t.Fatal("countFDs is not supported")
+	}
+	var files []*os.File
+	for i := 0; i < 3; i++ {
+		f, err := os.Open(os.Args[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	opened, _ := countFDs()
+	for _, f := range files {
+		f.Close()
+	}
+	closed, _ := countFDs()
+	if opened < before+len(files) {
+		t.Errorf("countFDs = %d with %d files opened, want at least %d", opened, len(files), before+len(files))
+	}
+	if closed > opened-len(files) {
+		t.Errorf("countFDs = %d once the files were closed, want at most %d", closed, opened-len(files))
+	}
+}
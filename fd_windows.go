@@ -0,0 +1,21 @@
+package goleaker
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var getProcessHandleCount = syscall.NewLazyDLL("kernel32.dll").NewProc("GetProcessHandleCount")
+
+// countFDs counts the handles of the process, of which files are one kind.
+func countFDs() (int, bool) {
+	p, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, false
+	}
+	var n uint32
+	if r, _, _ := getProcessHandleCount.Call(uintptr(p), uintptr(unsafe.Pointer(&n))); r == 0 {
+		return 0, false
+	}
+	return int(n), true
+}
@@ -0,0 +1,26 @@
+package goleaker
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestCountFDsDuplicateHandle(t *testing.T) {
+	before, ok := countFDs()
+	if !ok {
+		t.Fatal("countFDs is not supported")
+	}
+	p, err := syscall.GetCurrentProcess()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h syscall.Handle
+	if err := syscall.DuplicateHandle(p, p, p, &h, 0, false, syscall.DUPLICATE_SAME_ACCESS); err != nil {
+		t.Fatal(err)
+	}
+	opened, _ := countFDs()
+	syscall.CloseHandle(h)
+	if opened < before+1 {
+		t.Errorf("countFDs = %d with a duplicated handle open, want at least %d", opened, before+1)
+	}
+}
@@ -0,0 +1,72 @@
+package goleaker
+
+import "encoding/json"
+
+// Finding is a leak other than of goroutines found by a check, such as a
+// child process, a temporary file or an unreleased resource.
+type Finding struct {
+	// Kind is what leaked, e.g. "child process", empty if unknown.
+	Kind string `json:"kind,omitempty"`
+	// Message describes the leak and Stack, if known, where the leaked
+	// thing was made.
+	Message string `json:"message"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+func (f Finding) String() string {
+	if f.Stack == "" {
+		return f.Message
+	}
+	return f.Message + ", created at:\n" + f.Stack
+}
+
+// FindingFormatter is implemented by the Formatters which also render
+// findings, such as JSONFormatter. With other formatters findings are
+// reported as they are without any.
+type FindingFormatter interface {
+	FormatFinding(test string, f Finding) string
+}
+
+// ReportFinding reports f as the checks configured by opts do: failing t
+// with a message, rendered by the formatter of WithFormatter if it is a
+// FindingFormatter, or handing f to the sinks in WithDryRun mode. It is
+// for checks built outside of goleaker, such as those of package resource.
+func ReportFinding(t ErrorReporter, f Finding, opts ...Option) {
+	o := newOptions(opts)
+	if o.testName = testName(t); o.testName != "" {
+		t = namedReporter{ErrorReporter: t, name: o.testName}
+	}
+	o.reportFinding(t, f)
+}
+
+// reportFinding reports f to t, named after o.testName.
+func (o *options) reportFinding(t ErrorReporter, f Finding) {
+	if o.dryRun {
+		o.sink(MonitorReport{Test: o.testName, Findings: []Finding{f}})
+		return
+	}
+	if ff, ok := o.formatter.(FindingFormatter); ok {
+		t.Errorf("%s", ff.FormatFinding(o.testName, f))
+		return
+	}
+	t.Errorf("leaktest: %s", f)
+}
+
+// jsonFormatter is JSONFormatter.
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(r LeakReport) string {
+	return formatJSON(r)
+}
+
+func (jsonFormatter) FormatFinding(test string, f Finding) string {
+	out := struct {
+		Test string `json:"test,omitempty"`
+		Finding
+	}{test, f}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "leaktest: " + err.Error()
+	}
+	return string(b)
+}
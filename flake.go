@@ -0,0 +1,89 @@
+package goleaker
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// FlakeThreshold is the share of recorded runs below which a leak counts
+// as flaky with WithFlakeTracking.
+var FlakeThreshold = 0.5
+
+// FlakeMinRuns is how many runs have to be recorded before a leak can
+// count as flaky.
+var FlakeMinRuns = 5
+
+// WithFlakeTracking records in the JSON file at path, per test and
+// signature, how often the check passed and leaked. Leaks seen in fewer
+// than FlakeThreshold of the runs are labeled "flaky (quarantined)", to
+// tell deterministic leaks from shutdown races.
+func WithFlakeTracking(path string) Option {
+	return func(o *options) {
+		o.flakeFile = path
+	}
+}
+
+// WithFlakeQuarantine makes the flaky leaks found by WithFlakeTracking
+// non-failing; they are only logged.
+func WithFlakeQuarantine() Option {
+	return func(o *options) {
+		o.flakeQuarantine = true
+	}
+}
+
+// flakeHistory is the content of a flake tracking file.
+type flakeHistory map[string]*flakeRecord
+
+type flakeRecord struct {
+	Runs  int            `json:"runs"`
+	Leaks map[string]int `json:"leaks"`
+}
+
+var flakeMu sync.Mutex
+
+// recordFlakes records a run of the check which leaked leaked, and
+// returns the ids of the flaky ones.
+func (o *options) recordFlakes(t ErrorReporter, leaked []*Goroutine) map[uint64]bool {
+	if o.flakeFile == "" {
+		return nil
+	}
+	flakeMu.Lock()
+	defer flakeMu.Unlock()
+	h := flakeHistory{}
+	data, err := os.ReadFile(o.flakeFile)
+	if err == nil {
+		err = json.Unmarshal(data, &h)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("leaktest: flake tracking: %s", err)
+		return nil
+	}
+	r := h[o.testName]
+	if r == nil {
+		r = &flakeRecord{}
+		h[o.testName] = r
+	}
+	if r.Leaks == nil {
+		r.Leaks = map[string]int{}
+	}
+	r.Runs++
+	flaky := map[uint64]bool{}
+	for _, gr := range groupGoroutines(leaked) {
+		r.Leaks[gr.id]++
+		if r.Runs >= FlakeMinRuns && float64(r.Leaks[gr.id]) < FlakeThreshold*float64(r.Runs) {
+			for _, g := range gr.goroutines {
+				flaky[g.ID] = true
+			}
+		}
+	}
+	if data, err = json.MarshalIndent(h, "", "  "); err == nil {
+		err = os.WriteFile(o.flakeFile, data, 0o644)
+	}
+	if err != nil {
+		t.Errorf("leaktest: flake tracking: %s", err)
+	}
+	return flaky
+}
@@ -0,0 +1,18 @@
+package goleaker
+
+import "time"
+
+// WithFlightRecorder runs the runtime/trace flight recorder from the
+// baseline until the end of the check, keeping at least the last window of
+// the execution trace. When goroutines leak, the window is written to a
+// file in dir, so go tool trace shows how the leaked goroutines were
+// created and where they last blocked. Only one flight recorder can run
+// in a process, so checks running in parallel go without. The flight
+// recorder needs Go 1.25; built with earlier versions, the option only
+// logs that it has no effect.
+func WithFlightRecorder(dir string, window time.Duration) Option {
+	return func(o *options) {
+		o.flightDir = dir
+		o.flightWindow = window
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !go1.25
+
+package goleaker
+
+type flightRecorder struct{}
+
+func (o *options) startFlightRecorder(t ErrorReporter) {
+	if o.flightDir != "" {
+		logf(t, "leaktest: flight recorder: needs Go 1.25")
+	}
+}
+
+func (o *options) stopFlightRecorder() {}
+
+func (o *options) dumpFlightRecorder(t ErrorReporter) {}
@@ -0,0 +1,50 @@
+//go:build go1.25
+
+package goleaker
+
+import (
+	"os"
+	"runtime/trace"
+)
+
+type flightRecorder = trace.FlightRecorder
+
+// startFlightRecorder starts the flight recorder if one is configured.
+func (o *options) startFlightRecorder(t ErrorReporter) {
+	if o.flightDir == "" {
+		return
+	}
+	rec := trace.NewFlightRecorder(trace.FlightRecorderConfig{MinAge: o.flightWindow})
+	if err := rec.Start(); err != nil {
+		logf(t, "leaktest: flight recorder: %s", err)
+		return
+	}
+	o.recorder = rec
+}
+
+func (o *options) stopFlightRecorder() {
+	if o.recorder != nil {
+		o.recorder.Stop()
+	}
+}
+
+// dumpFlightRecorder writes the trace window to a new file.
+func (o *options) dumpFlightRecorder(t ErrorReporter) {
+	if o.recorder == nil {
+		return
+	}
+	f, err := os.CreateTemp(o.flightDir, "goleaker-*.trace")
+	if err != nil {
+		t.Errorf("leaktest: flight recorder: %s", err)
+		return
+	}
+	_, err = o.recorder.WriteTo(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Errorf("leaktest: flight recorder: %s", err)
+		return
+	}
+	t.Errorf("leaktest: execution trace of the leak written to %s, see go tool trace", f.Name())
+}
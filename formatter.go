@@ -0,0 +1,148 @@
+package goleaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LeakReport is what a check found when goroutines leaked, as handed to a
+// Formatter.
+type LeakReport struct {
+	// Test is the name of the test, empty outside of tests.
+	Test string
+	// Cause is why the check stopped waiting, e.g. "context deadline
+	// exceeded (timed out after 1s)".
+	Cause string
+	// Before and After are the numbers of goroutines the check considered
+	// when it began and when it gave up, Peak the most goroutines
+	// captured in between.
+	Before, After, Peak int
+	Leaks               []Leak
+	// Timeline are the checkpoints of Mark, from the start of the check
+	// to the end of the test, nil without marks.
+	Timeline []Checkpoint
+
+	before, after []*Goroutine
+}
+
+// Formatter renders the failure message of a check which found leaks,
+// e.g. to link runbooks or mention the owners of a signature.
+type Formatter interface {
+	Format(r LeakReport) string
+}
+
+// FormatterFunc adapts a function to a Formatter.
+type FormatterFunc func(r LeakReport) string
+
+func (f FormatterFunc) Format(r LeakReport) string { return f(r) }
+
+// WithFormatter reports leaks as a single message rendered by f instead of
+// the summary and one message per goroutine.
+func WithFormatter(f Formatter) Option {
+	return func(o *options) {
+		o.formatter = f
+	}
+}
+
+// The formatters shipped with goleaker.
+var (
+	// DefaultFormatter renders the summary of a check followed by the
+	// stack of every leaked goroutine.
+	DefaultFormatter Formatter = FormatterFunc(formatDefault)
+	// CompactFormatter renders one line per signature, without stacks.
+	CompactFormatter Formatter = FormatterFunc(formatCompact)
+	// JSONFormatter renders the report, and findings, as a JSON object on
+	// one line.
+	JSONFormatter Formatter = jsonFormatter{}
+)
+
+// prefix is the start of the messages of the built-in formatters.
+func (r LeakReport) prefix() string {
+	if r.Test != "" {
+		return "leaktest: " + r.Test + ": "
+	}
+	return "leaktest: "
+}
+
+// groups groups the leaked goroutines by signature, with their owners.
+func (r LeakReport) groups() []*group {
+	gs := make([]*Goroutine, len(r.Leaks))
+	owners := map[*Goroutine]string{}
+	for i, l := range r.Leaks {
+		gs[i] = l.Goroutine
+		owners[l.Goroutine] = l.Owner
+	}
+	groups := groupGoroutines(gs)
+	for _, gr := range groups {
+		gr.owner = owners[gr.goroutines[0]]
+	}
+	return groups
+}
+
+func formatDefault(r LeakReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s, still waiting on %d goroutine(s), peaked at %s goroutines:\n%s",
+		r.prefix(), r.Cause, len(r.Leaks), formatCount(r.Peak), formatDelta(r.before, r.after, r.groups()))
+	b.WriteString(formatTimeline(r.Timeline))
+	for _, l := range r.Leaks {
+		info := "sig " + l.Signature + ", " + string(l.Class)
+		if age, ok := l.Goroutine.Age(); ok {
+			info += ", age " + age.Round(time.Millisecond).String()
+		}
+		if l.Owner != "" {
+			info += ", likely owner: " + l.Owner
+		}
+		if l.Blame != nil {
+			info += ", " + l.Blame.String()
+		}
+		fmt.Fprintf(&b, "\nleaked goroutine (%s): %s", info, l.Goroutine.Stack)
+	}
+	return b.String()
+}
+
+func formatCompact(r LeakReport) string {
+	return fmt.Sprintf("%s%d goroutine(s) leaked, %s:\n%s", r.prefix(), len(r.Leaks), r.Cause, formatGroups(r.groups()))
+}
+
+func formatJSON(r LeakReport) string {
+	type jsonLeak struct {
+		ID        uint64    `json:"id"`
+		Signature string    `json:"signature"`
+		Class     LeakClass `json:"class"`
+		State     string    `json:"state"`
+		Top       string    `json:"top,omitempty"`
+		Owner     string    `json:"owner,omitempty"`
+		CreatedBy string    `json:"created_by,omitempty"`
+		Blame     *Blame    `json:"blame,omitempty"`
+		Stack     string    `json:"stack"`
+	}
+	out := struct {
+		Test     string       `json:"test,omitempty"`
+		Cause    string       `json:"cause"`
+		Before   int          `json:"before"`
+		After    int          `json:"after"`
+		Peak     int          `json:"peak"`
+		Leaks    []jsonLeak   `json:"leaks"`
+		Timeline []Checkpoint `json:"timeline,omitempty"`
+	}{Test: r.Test, Cause: r.Cause, Before: r.Before, After: r.After, Peak: r.Peak, Leaks: []jsonLeak{}, Timeline: r.Timeline}
+	for _, l := range r.Leaks {
+		jl := jsonLeak{ID: l.Goroutine.ID, Signature: l.Signature, Class: l.Class, State: l.Goroutine.State, Owner: l.Owner,
+			CreatedBy: l.Goroutine.CreatedBy, Blame: l.Blame, Stack: l.Goroutine.Stack}
+		if len(l.Goroutine.Frames) > 0 {
+			jl.Top = l.Goroutine.Frames[0].Func
+		}
+		out.Leaks = append(out.Leaks, jl)
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return r.prefix() + err.Error()
+	}
+	return string(b)
+}
+
+func newLeakReport(o *options, cause string, before, after []*Goroutine, peak int, leaked []*Goroutine) LeakReport {
+	return LeakReport{Test: o.testName, Cause: cause, Before: len(before), After: len(after), Peak: peak,
+		Leaks: newLeaks(o, leaked), before: before, after: after}
+}
@@ -1,3 +1,3 @@
 module github.com/rfyiamcool/goleaker
 
-go 1.12
+go 1.24
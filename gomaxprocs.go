@@ -0,0 +1,29 @@
+package goleaker
+
+import (
+	"runtime"
+	"strconv"
+)
+
+// ForEachGOMAXPROCS runs fn as a subtest of t for every value of procs,
+// with GOMAXPROCS set to it and checked for leaks with opts, since some
+// shutdown races only leak at some levels of parallelism:
+//
+//	goleaker.ForEachGOMAXPROCS(t, []int{1, 4, 16}, func(t *testing.T) {
+//		...
+//	})
+//
+// The subtests are named "GOMAXPROCS=n". GOMAXPROCS is global, so they
+// must not run in parallel with other tests. It returns whether every
+// subtest passed.
+func ForEachGOMAXPROCS[T runner[T]](t T, procs []int, fn func(T), opts ...Option) bool {
+	ok := true
+	for _, n := range procs {
+		ok = t.Run("GOMAXPROCS="+strconv.Itoa(n), func(sub T) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(n))
+			defer Check(sub, opts...)()
+			fn(sub)
+		}) && ok
+	}
+	return ok
+}
@@ -0,0 +1,127 @@
+package goleaker
+
+import "time"
+
+// GrowthPolicy makes a Monitor alert on sustained growth of a signature
+// instead of on every new goroutine, so legitimate fan-out bursts do not
+// page anyone.
+type GrowthPolicy struct {
+	// Window is the sliding window growth rates are computed over.
+	Window time.Duration
+	// Rate is the growth in goroutines per minute above which a
+	// signature counts as growing. Growth has to fall below half of
+	// Rate before the signature stops growing again.
+	Rate float64
+	// Sustain is the number of consecutive captures a signature has to
+	// be growing before an alert fires.
+	Sustain int
+	// Cooldown is the minimum time between two alerts for the same
+	// signature.
+	Cooldown time.Duration
+}
+
+// Growth describes a signature whose goroutine count keeps growing.
+type Growth struct {
+	Signature string
+	// ID is the SignatureID of the signature.
+	ID string
+	// Count is the number of goroutines with the signature.
+	Count int
+	// Rate is the growth in goroutines per minute over the window.
+	Rate float64
+}
+
+// WithGrowthPolicy makes a Monitor report only signatures growing as
+// described by p.
+func WithGrowthPolicy(p GrowthPolicy) Option {
+	return func(o *options) {
+		o.growth = &p
+	}
+}
+
+type growthSample struct {
+	t     time.Time
+	count int
+}
+
+type sigHistory struct {
+	id        string
+	samples   []growthSample
+	streak    int
+	growing   bool
+	lastAlert time.Time
+}
+
+// growthTracker keeps the recent counts of every signature.
+type growthTracker struct {
+	sigs map[string]*sigHistory
+}
+
+// observe records the counts of groups at now and returns the signatures
+// an alert fires for.
+func (gt *growthTracker) observe(p *GrowthPolicy, now time.Time, groups []*group) []Growth {
+	if gt.sigs == nil {
+		gt.sigs = map[string]*sigHistory{}
+	}
+	counts := map[string]int{}
+	ids := map[string]string{}
+	for _, gr := range groups {
+		counts[gr.sig] = len(gr.goroutines)
+		ids[gr.sig] = gr.id
+	}
+	for sig := range gt.sigs {
+		if _, ok := counts[sig]; !ok {
+			counts[sig] = 0
+		}
+	}
+
+	var alerts []Growth
+	for sig, n := range counts {
+		h := gt.sigs[sig]
+		if h == nil {
+			h = &sigHistory{id: ids[sig]}
+			gt.sigs[sig] = h
+		}
+		h.samples = append(h.samples, growthSample{t: now, count: n})
+		for len(h.samples) > 1 && now.Sub(h.samples[1].t) >= p.Window {
+			h.samples = h.samples[1:]
+		}
+		if n == 0 && !h.growing {
+			idle := true
+			for _, s := range h.samples {
+				idle = idle && s.count == 0
+			}
+			if idle && now.Sub(h.samples[0].t) >= p.Window {
+				delete(gt.sigs, sig)
+				continue
+			}
+		}
+
+		rate := h.rate()
+		switch {
+		case rate > p.Rate:
+			h.streak++
+		case rate < p.Rate/2:
+			h.streak = 0
+			h.growing = false
+		}
+		if h.streak >= p.Sustain && h.streak > 0 && !h.growing {
+			h.growing = true
+			if h.lastAlert.IsZero() || now.Sub(h.lastAlert) >= p.Cooldown {
+				h.lastAlert = now
+				alerts = append(alerts, Growth{Signature: sig, ID: h.id, Count: n, Rate: rate})
+			}
+		}
+	}
+	return alerts
+}
+
+// rate returns the growth in goroutines per minute over the samples.
+func (h *sigHistory) rate() float64 {
+	first, last := h.samples[0], h.samples[len(h.samples)-1]
+	elapsed := last.t.Sub(first.t)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.count-first.count) / elapsed.Minutes()
+}
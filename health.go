@@ -0,0 +1,55 @@
+package goleaker
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// DefaultHealthThreshold is the number of leak suspects above which a
+// Monitor's health handler fails, unless WithHealthThreshold says
+// otherwise.
+var DefaultHealthThreshold = 10000
+
+// WithHealthThreshold sets how many goroutines started since the baseline
+// a Monitor tolerates before its HealthHandler reports the process as
+// unhealthy.
+func WithHealthThreshold(n int) Option {
+	return func(o *options) {
+		o.healthThreshold = n
+	}
+}
+
+// HealthHandler returns a handler for a liveness or readiness probe,
+// usually mounted at /healthz/goroutines. It responds with 503 Service
+// Unavailable once the last capture of the Monitor found more leak
+// suspects than the health threshold, so a leaking pod can be recycled.
+// The report is logged when the process turns unhealthy, for postmortems.
+func (m *Monitor) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		last := m.last
+		threshold := m.o.healthThreshold
+		if threshold <= 0 {
+			threshold = DefaultHealthThreshold
+		}
+		healthy := len(last.Leaked) <= threshold
+		turned := !healthy && !m.unhealthy
+		m.unhealthy = !healthy
+		m.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if healthy {
+			fmt.Fprintf(w, "ok: %d leak suspect(s), threshold %d\n", len(last.Leaked), threshold)
+			return
+		}
+		summary := monitorSummary(last, groupGoroutines(last.Leaked))
+		if turned {
+			log.Printf("%s\ngoleaker: unhealthy, %d leak suspect(s) exceed the threshold of %d",
+				summary, len(last.Leaked), threshold)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "unhealthy: %d leak suspect(s) exceed the threshold of %d\n%s\n",
+			len(last.Leaked), threshold, summary)
+	})
+}
@@ -0,0 +1,182 @@
+package goleaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Snapshot is the summary of one Monitor capture kept in its history.
+type Snapshot struct {
+	Time       time.Time `json:"time"`
+	Goroutines int       `json:"goroutines"`
+	// Counts maps the signature of leaked goroutines to their number.
+	Counts map[string]int `json:"counts"`
+	// IDs maps the signatures in Counts to their SignatureID.
+	IDs map[string]string `json:"ids"`
+}
+
+// WithHistory makes a Monitor keep its last n snapshots in memory.
+func WithHistory(n int) Option {
+	return func(o *options) {
+		o.history = n
+	}
+}
+
+// WithMemoryLimit caps the memory a Monitor spends on its snapshot
+// history at about bytes, dropping the oldest snapshots beyond it. Frames
+// are shared between all snapshots, so in a process with 100k goroutines
+// parked at a few hundred places each snapshot costs little.
+func WithMemoryLimit(bytes int) Option {
+	return func(o *options) {
+		o.memoryLimit = bytes
+	}
+}
+
+type compactSnapshot struct {
+	t          time.Time
+	goroutines int
+	counts     map[uint32]int
+}
+
+func (s *compactSnapshot) bytes() int {
+	return 64 + 16*len(s.counts)
+}
+
+// snapshotRing holds the last snapshots, oldest first, with their
+// signatures interned in a frame table.
+type snapshotRing struct {
+	snaps []compactSnapshot
+	table frameTable
+}
+
+func (r *snapshotRing) add(n, limit int, t time.Time, goroutines int, groups []*group) {
+	if n <= 0 {
+		return
+	}
+	s := compactSnapshot{t: t, goroutines: goroutines, counts: make(map[uint32]int, len(groups))}
+	for _, gr := range groups {
+		s.counts[r.table.intern(gr.sig, gr.id, gr.label())] += len(gr.goroutines)
+	}
+	r.snaps = append(r.snaps, s)
+	drop := len(r.snaps) - n
+	if limit > 0 {
+		size := r.table.bytes
+		for _, s := range r.snaps {
+			size += s.bytes()
+		}
+		for i := 0; size > limit && i < len(r.snaps)-1; i++ {
+			size -= r.snaps[i].bytes()
+			if i+1 > drop {
+				drop = i + 1
+			}
+		}
+	}
+	if drop <= 0 {
+		return
+	}
+	r.snaps = append(r.snaps[:0:0], r.snaps[drop:]...)
+	r.compact()
+}
+
+// compact rebuilds the frame table with the signatures still in use.
+func (r *snapshotRing) compact() {
+	old := r.table
+	r.table = frameTable{}
+	for i := range r.snaps {
+		counts := make(map[uint32]int, len(r.snaps[i].counts))
+		for si, n := range r.snaps[i].counts {
+			counts[r.table.intern(old.signature(si), old.id(si), old.label(si))] = n
+		}
+		r.snaps[i].counts = counts
+	}
+}
+
+// list returns the snapshots oldest first and the label of every
+// signature in them.
+func (r *snapshotRing) list() ([]Snapshot, map[string]string) {
+	snaps := make([]Snapshot, 0, len(r.snaps))
+	labels := map[string]string{}
+	for _, s := range r.snaps {
+		counts := make(map[string]int, len(s.counts))
+		ids := make(map[string]string, len(s.counts))
+		for si, n := range s.counts {
+			sig := r.table.signature(si)
+			counts[sig] = n
+			ids[sig] = r.table.id(si)
+			labels[sig] = r.table.label(si)
+		}
+		snaps = append(snaps, Snapshot{Time: s.t, Goroutines: s.goroutines, Counts: counts, IDs: ids})
+	}
+	return snaps, labels
+}
+
+// History returns the snapshots kept with WithHistory, oldest first.
+func (m *Monitor) History() []Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snaps, _ := m.history.list()
+	return snaps
+}
+
+// DebugHandler returns a handler showing the snapshot history, so when an
+// alert fires an operator can see when each leaking signature started
+// growing. It responds with JSON when the format query parameter is
+// "json" and with a plain text table otherwise.
+func (m *Monitor) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		snaps, labels := m.history.list()
+		m.mu.Unlock()
+
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(snaps)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeHistory(w, snaps, labels)
+	})
+}
+
+// writeHistory writes one row per snapshot and, per signature, when it was
+// first seen and how its count developed.
+func writeHistory(w io.Writer, snaps []Snapshot, labels map[string]string) {
+	fmt.Fprintf(w, "goleaker: %d snapshot(s)\n\n", len(snaps))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "time\tgoroutines\tleaked")
+	for _, s := range snaps {
+		n := 0
+		for _, c := range s.Counts {
+			n += c
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", s.Time.Format(time.RFC3339), s.Goroutines, n)
+	}
+	tw.Flush()
+
+	sigs := make([]string, 0, len(labels))
+	for sig := range labels {
+		sigs = append(sigs, sig)
+	}
+	last := map[string]int{}
+	if len(snaps) > 0 {
+		last = snaps[len(snaps)-1].Counts
+	}
+	sort.Slice(sigs, func(i, j int) bool { return last[sigs[i]] > last[sigs[j]] })
+	for _, sig := range sigs {
+		var counts []string
+		first := ""
+		for _, s := range snaps {
+			if s.Counts[sig] > 0 && first == "" {
+				first = s.Time.Format(time.RFC3339)
+			}
+			counts = append(counts, fmt.Sprint(s.Counts[sig]))
+		}
+		fmt.Fprintf(w, "\n%s\n\tfirst seen %s, counts %s\n", labels[sig], first, strings.Join(counts, " "))
+	}
+}
@@ -0,0 +1,148 @@
+package goleaker
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// HTTPTestServerGracePeriod is how long CheckHTTPTestServer waits for the
+// goroutines of a closed server to exit unless WithTimeout says otherwise.
+var HTTPTestServerGracePeriod = time.Second
+
+// serveFrame is the frame of the serving goroutine of an http.Server, with
+// the listener among its arguments.
+const serveFrame = "net/http.(*Server).Serve("
+
+// CheckHTTPTestServer closes srv and reports the goroutines serving its
+// connections that are still running after the grace period, such as the
+// ones of hijacked connections or handlers that never return. Close runs
+// in the background and the grace period starts with it, since Close
+// waits for every active request; checks ignore it should it never
+// return. Only the goroutines descending from the serving goroutine of
+// srv count, so other servers and clients of the same test do not get in
+// the way. Stack dumps do not show the address of srv.Listener, so the
+// serving goroutine is told by the listener it passes to
+// http.Server.Serve, printed among the arguments of the frame. Goroutines
+// whose creator exited before the check cannot be traced back to srv and
+// are missed. Call it instead of srv.Close.
+func CheckHTTPTestServer(t ErrorReporter, srv *httptest.Server, opts ...Option) {
+	o := newOptions(opts)
+	t = o.reporter(t)
+	if o.testName = testName(t); o.testName != "" {
+		t = namedReporter{ErrorReporter: t, name: o.testName}
+	}
+	grace := scaled(HTTPTestServerGracePeriod)
+	if o.hasTimeout {
+		grace = o.timeout
+	}
+	before, _ := o.source.Capture()
+	tree := goroutineTree{}
+	if l := listenerArg(srv); l != "" {
+		for _, g := range before {
+			if servesOn(&g, l) {
+				tree[g.ID] = true
+			}
+		}
+	}
+	tree.grow(before)
+	closed := make(chan struct{})
+	go closeHTTPTestServer(srv, closed)
+	if len(tree) == 0 {
+		logf(t, "leaktest: cannot tell the goroutine serving httptest server %s, not checked", srv.URL)
+		return
+	}
+	deadline := time.Now().Add(grace)
+	for {
+		all, _ := o.source.Capture()
+		alive := tree.alive(o, all)
+		select {
+		case <-closed:
+			if len(alive) == 0 {
+				return
+			}
+		default:
+		}
+		if time.Now().After(deadline) {
+			if len(alive) > 0 {
+				reportGoroutines(t, o, fmt.Sprintf("%d goroutine(s) of httptest server %s still running after Close", len(alive), srv.URL),
+					alive, len(tree))
+			}
+			return
+		}
+		time.Sleep(o.pollInterval())
+	}
+}
+
+// closeHTTPTestServer closes srv in the background for CheckHTTPTestServer,
+// and is ignored by checks since Close blocks for good on handlers that
+// never return.
+func closeHTTPTestServer(srv *httptest.Server, closed chan struct{}) {
+	defer close(closed)
+	srv.Close()
+}
+
+// goroutineTree is a set of goroutines and every goroutine they started,
+// tracked by id since creators may exit before their children.
+type goroutineTree map[uint64]bool
+
+// listenerArg returns the listener of srv as printed among the arguments
+// of its Serve frame, or "" if it is not a pointer.
+func listenerArg(srv *httptest.Server) string {
+	v := reflect.ValueOf(srv.Listener)
+	if v.Kind() != reflect.Pointer {
+		return ""
+	}
+	return fmt.Sprintf("%#x", v.Pointer())
+}
+
+// servesOn reports whether g is an http.Server serving the listener l.
+func servesOn(g *Goroutine, l string) bool {
+	i := strings.Index(g.Stack, "\n"+serveFrame)
+	if i < 0 {
+		return false
+	}
+	args := g.Stack[i+1+len(serveFrame):]
+	if j := strings.IndexByte(args, '\n'); j >= 0 {
+		args = args[:j]
+	}
+	for _, arg := range strings.FieldsFunc(args, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '{' || r == '}' || r == ')'
+	}) {
+		// the runtime marks possibly stale register arguments with a ?
+		if strings.TrimSuffix(arg, "?") == l {
+			return true
+		}
+	}
+	return false
+}
+
+// grow adds the goroutines of all started by a goroutine of the tree.
+func (tree goroutineTree) grow(all []Goroutine) {
+	for added := true; added; {
+		added = false
+		for _, g := range all {
+			if tree[g.ID] {
+				continue
+			}
+			if id, ok := creatorGoroutine(g.Stack); ok && tree[id] {
+				tree[g.ID] = true
+				added = true
+			}
+		}
+	}
+}
+
+// alive returns the interesting goroutines of the tree running in all.
+func (tree goroutineTree) alive(o *options, all []Goroutine) []*Goroutine {
+	tree.grow(all)
+	var alive []*Goroutine
+	for i := range all {
+		if g := &all[i]; tree[g.ID] && o.interesting(g) {
+			alive = append(alive, g)
+		}
+	}
+	return alive
+}
@@ -0,0 +1,63 @@
+package goleaker
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckHTTPTestServer(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+	defer func() {
+		close(release)
+		hung.Close()
+	}()
+	go func() {
+		if resp, err := http.Get(hung.URL); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	resp, err := http.Get(ok.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// both servers are closed at once, each check only sees its own
+	var wg sync.WaitGroup
+	hungErrs, okErrs := &reporter{}, &reporter{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		CheckHTTPTestServer(hungErrs, hung, WithTimeout(200*time.Millisecond))
+	}()
+	go func() {
+		defer wg.Done()
+		CheckHTTPTestServer(okErrs, ok, WithTimeout(200*time.Millisecond))
+	}()
+	wg.Wait()
+	if got, want := hungErrs.errors(), "goroutine(s) of httptest server "+hung.URL+" still running after Close"; !strings.Contains(got, want) {
+		t.Errorf("CheckHTTPTestServer(hung) reported %q, want it to contain %q", got, want)
+	}
+	if got := okErrs.errors(); got != "" || len(okErrs.logs) > 0 {
+		t.Errorf("CheckHTTPTestServer(ok) reported %q and logged %q, want nothing", got, okErrs.logs)
+	}
+	for _, g := range interestingGoroutines(t, newOptions(nil)) {
+		if strings.Contains(g.Stack, ".closeHTTPTestServer(") {
+			t.Errorf("the Close goroutine of CheckHTTPTestServer is not ignored:\n%s", g.Stack)
+		}
+	}
+}
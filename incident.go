@@ -0,0 +1,92 @@
+package goleaker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Incident is an alert of a Monitor with WithAlertDedup on one leaking
+// signature, open until the signature stops leaking.
+type Incident struct {
+	// Fingerprint identifies the incident of a signature across reports
+	// and restarts, e.g. as the dedup key of an alerting system. It is
+	// derived from the name of the program and the SignatureID.
+	Fingerprint string `json:"fingerprint"`
+	// ID is the SignatureID of the signature.
+	ID string `json:"id"`
+	// Count is the number of leaked goroutines with the signature when
+	// last seen leaking.
+	Count int `json:"count"`
+	// Opened is when the incident was first alerted on, Alerted when last,
+	// and Resolved when the signature stopped leaking.
+	Opened   time.Time `json:"opened"`
+	Alerted  time.Time `json:"alerted"`
+	Resolved time.Time `json:"resolved,omitzero"`
+}
+
+// WithAlertDedup makes a Monitor alert on every leaking signature as an
+// Incident with a stable fingerprint, and alert again on an open incident
+// only once window passed since the last alert. Once the signature stops
+// leaking, or stops growing with WithGrowthPolicy, the Monitor sends a
+// report resolving the incident.
+func WithAlertDedup(window time.Duration) Option {
+	return func(o *options) {
+		o.alertDedup = window
+	}
+}
+
+// Fingerprint returns the fingerprint of the incidents of the signature
+// with the given SignatureID.
+func Fingerprint(id string) string {
+	h := sha256.Sum256([]byte(filepath.Base(os.Args[0]) + "\x00" + id))
+	return hex.EncodeToString(h[:8])
+}
+
+// incidentTracker keeps the open incidents of a Monitor by SignatureID,
+// which signatures only differing in lines share.
+type incidentTracker struct {
+	open map[string]*Incident
+}
+
+// observe opens or extends the incidents of the signatures of groups,
+// leaking at now, and resolves those of the others. It returns the
+// incidents to alert on, which are new or were last alerted on window
+// ago, and the resolved ones.
+func (it *incidentTracker) observe(window time.Duration, now time.Time, groups []*group) (alerts, resolved []Incident) {
+	if it.open == nil {
+		it.open = map[string]*Incident{}
+	}
+	counts := map[string]int{}
+	var ids []string
+	for _, gr := range groups {
+		if _, ok := counts[gr.id]; !ok {
+			ids = append(ids, gr.id)
+		}
+		counts[gr.id] += len(gr.goroutines)
+	}
+	for _, id := range ids {
+		inc := it.open[id]
+		if inc == nil {
+			inc = &Incident{Fingerprint: Fingerprint(id), ID: id, Opened: now}
+			it.open[id] = inc
+		}
+		inc.Count = counts[id]
+		if inc.Alerted.IsZero() || now.Sub(inc.Alerted) >= window {
+			inc.Alerted = now
+			alerts = append(alerts, *inc)
+		}
+	}
+	for id, inc := range it.open {
+		if _, ok := counts[id]; !ok {
+			inc.Resolved = now
+			resolved = append(resolved, *inc)
+			delete(it.open, id)
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Fingerprint < resolved[j].Fingerprint })
+	return alerts, resolved
+}
@@ -0,0 +1,78 @@
+package goleaker
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// frameTable interns the frames of signatures, so retained signatures
+// cost a list of frame indexes instead of a copy of their text.
+type frameTable struct {
+	frames     []string
+	frameIndex map[string]uint32
+	sigs       [][]uint32
+	ids        []string
+	labels     []string
+	sigIndex   map[string]uint32
+	bytes      int
+}
+
+// intern returns the index of the signature sig, as returned by signature,
+// with its SignatureID and the label describing its goroutines.
+func (ft *frameTable) intern(sig, id, label string) uint32 {
+	if ft.frameIndex == nil {
+		ft.frameIndex = map[string]uint32{}
+		ft.sigIndex = map[string]uint32{}
+	}
+	var frames []uint32
+	lines := strings.Split(strings.TrimSuffix(sig, "\n"), "\n")
+	for i := 0; i < len(lines); i += 2 {
+		frame := lines[i]
+		if i+1 < len(lines) {
+			frame += "\n" + lines[i+1]
+		}
+		fi, ok := ft.frameIndex[frame]
+		if !ok {
+			fi = uint32(len(ft.frames))
+			ft.frames = append(ft.frames, frame)
+			ft.frameIndex[frame] = fi
+			// the string is referenced by the slice and the map key
+			ft.bytes += len(frame) + 2*16 + 4
+		}
+		frames = append(frames, fi)
+	}
+	key := make([]byte, 4*len(frames))
+	for i, fi := range frames {
+		binary.LittleEndian.PutUint32(key[4*i:], fi)
+	}
+	si, ok := ft.sigIndex[string(key)]
+	if !ok {
+		si = uint32(len(ft.sigs))
+		ft.sigs = append(ft.sigs, frames)
+		ft.ids = append(ft.ids, id)
+		ft.labels = append(ft.labels, label)
+		ft.sigIndex[string(key)] = si
+		ft.bytes += 2*len(key) + len(id) + len(label) + 4*24
+	}
+	return si
+}
+
+// signature returns the signature text of the signature at index si.
+func (ft *frameTable) signature(si uint32) string {
+	var b strings.Builder
+	for _, f := range ft.sigs[si] {
+		b.WriteString(ft.frames[f])
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// id returns the SignatureID of the signature at index si.
+func (ft *frameTable) id(si uint32) string {
+	return ft.ids[si]
+}
+
+// label returns the label the signature at index si was interned with.
+func (ft *frameTable) label(si uint32) string {
+	return ft.labels[si]
+}
@@ -2,10 +2,7 @@ package goleaker
 
 import (
 	"context"
-	"fmt"
-	"runtime"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -16,111 +13,205 @@ func SetTickerInterval(d time.Duration) {
 	tickerInterval = d
 }
 
-type goroutine struct {
-	id    uint64
-	stack string
-}
-
-type goroutines []*goroutine
-
-func (g goroutines) Len() int           { return len(g) }
-func (g goroutines) Less(i, j int) bool { return g[i].id < g[j].id }
-func (g goroutines) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
-
-type filterFuncType func(string) bool
-
-var (
-	filterFuncs = make([]filterFuncType, 0, 20)
-)
-
-func AddFilter(fn filterFuncType) {
-	filterFuncs = append(filterFuncs, fn)
-}
-
-func interestingGoroutine(g string) (*goroutine, error) {
-	sl := strings.SplitN(g, "\n", 2)
-	if len(sl) != 2 {
-		return nil, fmt.Errorf("error parsing stack: %q", g)
+// interesting reports whether g is a goroutine we care about for the
+// purpose of leak checking.
+func (o *options) interesting(g *Goroutine) bool {
+	// goroutines that must be gone are reported even if an ignore rule
+	// would skip them
+	if o.required(g) {
+		return true
 	}
-	stack := strings.TrimSpace(sl[1])
-	if strings.HasPrefix(stack, "testing.RunTests") {
-		return nil, nil
+	body := g.body()
+	if !o.strict && keepaliveStack(body) {
+		return false
 	}
+	if o.cgoIgnored(g) {
+		return false
+	}
+	return !ignoredStack(body) && !exiting(g) && !systemGoroutine(g) && !o.ignored(g)
+}
 
-	// custom filter func
-	for _, fn := range filterFuncs {
-		if !fn(stack) {
+// exiting reports whether g is on its way out: dead, or with one of the
+// runtime functions tearing a goroutine down on top of its stack. Checks
+// used to spot these with a runtime.goexit substring anywhere in the
+// stack, which matches the final frame of every goroutine in crash
+// tracebacks.
+func exiting(g *Goroutine) bool {
+	if g.State == "dead" {
+		return true
+	}
+	for _, f := range g.Frames {
+		switch f.Func {
+		case "runtime.goexit0", "runtime.goexit1", "runtime.gdestroy":
+			return true
+		case "runtime.gopark", "runtime.goparkunlock", "runtime.mcall", "runtime.systemstack":
+			// runtime frames above the ones of interest
 			continue
 		}
-		return nil, nil
+		return false
 	}
+	return false
+}
+
+// Strict disables the built-in ignores of connection read and write loops
+// and keepalives, so tests have to close their transports and servers.
+// Library authors can use it for maximal leak hygiene in their own suites.
+func Strict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
 
-	if stack == "" ||
-		// Ignore HTTP keep alives
-		strings.Contains(stack, ").readLoop(") ||
+// keepaliveStack reports whether a stack, without its header line, is one
+// of the connection goroutines ignored unless Strict is set.
+func keepaliveStack(stack string) bool {
+	// Ignore HTTP keep alives
+	return strings.Contains(stack, ").readLoop(") ||
 		strings.Contains(stack, ").writeLoop(") ||
 
 		// Ignore http2 and grpc keepalive
-		strings.Contains(stack, "http2Server) keepalive(") ||
+		strings.Contains(stack, "http2Server) keepalive(")
+}
 
+// ignoredStack reports whether a stack, without its header line, is one
+// of the testing or runtime goroutines that are never leaks.
+func ignoredStack(stack string) bool {
+	if strings.HasPrefix(stack, "testing.RunTests") {
+		return true
+	}
+
+	return stack == "" ||
 		// Below are the stacks ignored by the upstream leaktest code.
 		strings.Contains(stack, "testing.Main(") ||
 		strings.Contains(stack, "testing.(*T).Run(") ||
-		strings.Contains(stack, "runtime.goexit") ||
 		strings.Contains(stack, "created by runtime.gc") ||
 		strings.Contains(stack, "interestingGoroutines") ||
+		strings.Contains(stack, "goleaker.(*options).sample(") ||
+		strings.Contains(stack, "goleaker.(*ceiling).sample(") ||
+		strings.Contains(stack, "goleaker.closeHTTPTestServer(") ||
 		strings.Contains(stack, "runtime.MHeap_Scavenger") ||
 		strings.Contains(stack, "signal.signal_recv") ||
 		strings.Contains(stack, "sigterm.handler") ||
-		strings.Contains(stack, "runtime_mcall") ||
-		strings.Contains(stack, "goroutine in C code") {
-		return nil, nil
-	}
-
-	// Parse the goroutine's ID from the header line.
-	h := strings.SplitN(sl[0], " ", 3)
-	if len(h) < 3 {
-		return nil, fmt.Errorf("error parsing stack header: %q", sl[0])
-	}
-	id, err := strconv.ParseUint(h[1], 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing goroutine id: %s", err)
-	}
-
-	return &goroutine{id: id, stack: strings.TrimSpace(g)}, nil
+		strings.Contains(stack, "runtime_mcall")
 }
 
 // interestingGoroutines returns all goroutines we care about for the purpose
 // of leak checking. It excludes testing or runtime ones.
-func interestingGoroutines(t ErrorReporter) []*goroutine {
-	buf := make([]byte, 2<<20)
-	buf = buf[:runtime.Stack(buf, true)]
-	var gs []*goroutine
-	for _, g := range strings.Split(string(buf), "\n\n") {
-		gr, err := interestingGoroutine(g)
-		if err != nil {
-			t.Errorf("leaktest: %s", err)
-			continue
-		} else if gr == nil {
-			continue
+func interestingGoroutines(t ErrorReporter, o *options) []*Goroutine {
+	gs, _ := captureGoroutines(t, o)
+	return gs
+}
+
+// captureGoroutines returns the interesting goroutines and the number of
+// goroutines captured.
+func captureGoroutines(t ErrorReporter, o *options) ([]*Goroutine, int) {
+	all, gs := captureRaw(t, o)
+	return gs, len(all)
+}
+
+// captureRaw returns every goroutine captured along with the interesting
+// ones.
+func captureRaw(t ErrorReporter, o *options) ([]Goroutine, []*Goroutine) {
+	all, err := o.source.Capture()
+	if err != nil {
+		t.Errorf("leaktest: %s", err)
+	}
+	var gs []*Goroutine
+	for i := range all {
+		if g := &all[i]; o.interesting(g) {
+			gs = append(gs, g)
 		}
-		gs = append(gs, gr)
 	}
 	sort.Sort(goroutines(gs))
-	return gs
+	return all, gs
+}
+
+// Interesting returns the goroutines of gs a check considers, leaving out
+// the testing, runtime and ignored ones, ordered by id. Tools use it to
+// apply the rules to goroutines captured elsewhere.
+func Interesting(gs []Goroutine, opts ...Option) []*Goroutine {
+	o := newOptions(opts)
+	var interesting []*Goroutine
+	for i := range gs {
+		if g := &gs[i]; o.interesting(g) {
+			interesting = append(interesting, g)
+		}
+	}
+	sort.Sort(goroutines(interesting))
+	return interesting
+}
+
+// baseline holds the goroutines running when a check began.
+type baseline struct {
+	ids map[uint64]bool
+	// start is when the baseline was taken, zero when the goroutines do
+	// not come from the running process.
+	start time.Time
+	// total is the number of goroutines captured.
+	total int
+	// raw are the goroutines captured, only kept for WithFailureArtifact.
+	raw []Goroutine
+	// gs are the interesting goroutines captured.
+	gs []*Goroutine
+	// sockets are the inodes of the sockets open, nil when the goroutines
+	// do not come from the running process or the platform lists none.
+	sockets map[uint64]bool
+}
+
+func takeBaseline(t ErrorReporter, o *options) baseline {
+	b := baseline{ids: map[uint64]bool{}}
+	if o.noBaseline {
+		return b
+	}
+	if _, ok := o.source.(runtimeSource); ok {
+		b.start = time.Now()
+		b.sockets, _ = openSocketInodes()
+	}
+	all, gs := captureRaw(t, o)
+	b.total = len(all)
+	b.gs = gs
+	if o.failureArtifact != "" {
+		b.raw = all
+	}
+	for _, g := range gs {
+		b.ids[g.ID] = true
+	}
+	return b
+}
+
+// contains reports whether g was running when the baseline was taken:
+// either its ID was captured, or it provably predates the baseline
+// because it has been blocked for longer or its CreatedLabel says so.
+// The latter covers goroutines missing from a truncated capture.
+func (b baseline) contains(g *Goroutine) bool {
+	if b.ids[g.ID] {
+		return true
+	}
+	if b.start.IsZero() {
+		return false
+	}
+	if g.Wait > time.Since(b.start) {
+		return true
+	}
+	created, ok := g.Created()
+	return ok && created.Before(b.start)
 }
 
 // leakedGoroutines returns all goroutines we are considering leaked and
 // the boolean flag indicating if no leaks detected
-func leakedGoroutines(orig map[uint64]bool, interesting []*goroutine) ([]string, bool) {
-	leaked := make([]string, 0)
+func leakedGoroutines(o *options, orig baseline, interesting []*Goroutine) ([]*Goroutine, bool) {
+	leaked := make([]*Goroutine, 0)
 	flag := true
 	for _, g := range interesting {
-		if !orig[g.id] {
-			leaked = append(leaked, g.stack)
+		if !orig.contains(g) {
+			leaked = append(leaked, g)
 			flag = false
 		}
 	}
+	if !flag {
+		leaked = o.withinBudget(leaked)
+		flag = len(leaked) == 0
+	}
 	return leaked, flag
 }
 
@@ -130,61 +221,222 @@ type ErrorReporter interface {
 	Errorf(format string, args ...interface{})
 }
 
+// logf logs through t if it also implements testing.TB's Logf.
+func logf(t ErrorReporter, format string, args ...interface{}) {
+	if l, ok := t.(interface{ Logf(string, ...interface{}) }); ok {
+		l.Logf(format, args...)
+	}
+}
+
+// failed reports whether t also implements testing.TB's Failed and the
+// test has already failed.
+func failed(t ErrorReporter) bool {
+	f, ok := t.(interface{ Failed() bool })
+	return ok && f.Failed()
+}
+
 // Check snapshots the currently-running goroutines and returns a
 // function to be run at the end of tests to see whether any
 // goroutines leaked.
-func Check(t ErrorReporter) func() {
-	return CheckTimeout(t, 0)
+func Check(t ErrorReporter, opts ...Option) func() {
+	opts = append([]Option{WithTimeout(0)}, opts...)
+	return CheckContext(context.Background(), t, opts...)
 }
 
-// CheckTimeout is the same as Check, but with a configurable timeout
-func CheckTimeout(t ErrorReporter, dur time.Duration) func() {
-	ctx, cancel := context.WithCancel(context.Background())
-	fn := CheckContext(ctx, t)
-	return func() {
-		timer := time.AfterFunc(dur, cancel)
-		fn()
-		// Remember to clean up the timer and context
-		timer.Stop()
-		cancel()
-	}
+// CheckTimeout is the same as Check, but with a configurable timeout.
+// The timeout starts when the returned function is called; a timeout of
+// zero or less checks once without any grace period.
+func CheckTimeout(t ErrorReporter, dur time.Duration, opts ...Option) func() {
+	opts = append(opts[:len(opts):len(opts)], WithTimeout(dur))
+	return CheckContext(context.Background(), t, opts...)
 }
 
 // CheckContext is the same as Check, but uses a context.Context for
 // cancellation and timeout control
-func CheckContext(ctx context.Context, t ErrorReporter) func() {
-	orig := map[uint64]bool{}
-	for _, g := range interestingGoroutines(t) {
-		orig[g.id] = true
+func CheckContext(ctx context.Context, t ErrorReporter, opts ...Option) func() {
+	o := newOptions(opts)
+	t = o.reporter(t)
+	if o.configErr != nil {
+		t.Errorf("leaktest: %s", o.configErr)
+	}
+	if o.requireCreatedInTest {
+		o.testFunc = currentTestFunc()
+	}
+	if o.testName = testName(t); o.testName != "" {
+		t = namedReporter{ErrorReporter: t, name: o.testName}
+	}
+	start := time.Now()
+	o.startFlightRecorder(t)
+	orig := takeBaseline(t, o)
+	startTimeline(o.testName, start, orig.total)
+	var base sampleCounts
+	if o.samplingLive() {
+		base, _ = o.sample()
 	}
 	return func() {
+		checkpoints := endTimeline(o.testName)
+		defer o.stopFlightRecorder()
+		if o.testName != "" {
+			defer recordTestRun(o.testName, start)
+		}
+		if o.skipOnFailed && failed(t) {
+			return
+		}
+		ctx, cancel := o.graceContext(ctx)
+		defer cancel()
+
 		var (
-			leaked []string
+			leaked []*Goroutine
 			ok     bool
+			clean  int
+			peak   = orig.total
+			// last is the latest full capture
+			last = orig.gs
 		)
+		capture := func() []*Goroutine {
+			gs, n := captureGoroutines(t, o)
+			if n > peak {
+				peak = n
+			}
+			o.sleepers.observe(gs)
+			last = gs
+			return gs
+		}
+		// poll compares cheap samples when sampling, and full dumps
+		// otherwise, which leaves leaked nil while sampling
+		poll := func() bool {
+			if o.chaos {
+				Chaos()
+			}
+			if base == nil {
+				leaked, ok = leakedGoroutines(o, orig, capture())
+				return ok
+			}
+			counts, n := o.sample()
+			if n > peak {
+				peak = n
+			}
+			if !counts.within(base) {
+				return false
+			}
+			// samples lack the creation frames creation based matchers
+			// need, so a full dump confirms the pass, and polls on if
+			// it disagrees
+			if leaked, ok = leakedGoroutines(o, orig, capture()); !ok {
+				base = nil
+			}
+			return ok
+		}
+		// full makes sure leaked comes from a full dump
+		full := func() bool {
+			if base != nil {
+				leaked, ok = leakedGoroutines(o, orig, capture())
+			}
+			return ok
+		}
+		passed := func() {
+			o.recordFlakes(t, nil)
+			logf(t, "leaktest: peaked at %s goroutines during test", formatCount(peak))
+		}
+		for _, fn := range o.beforeCheck {
+			fn()
+		}
+		if o.chaos {
+			o.chaosSeed = o.resolveChaosSeed(t)
+			o.settleChecks = max(o.settleChecks, ChaosChecks)
+			defer startChaos(o.chaosSeed)()
+		}
 		// fast check if we have no leaks
-		if leaked, ok = leakedGoroutines(orig, interestingGoroutines(t)); ok {
-			return
+		if poll() {
+			if clean++; clean >= o.settleChecks {
+				passed()
+				return
+			}
 		}
 
-		ticker := time.NewTicker(tickerInterval)
+		ticker := time.NewTicker(o.pollInterval())
 		defer ticker.Stop()
 
+		var grace <-chan time.Time
 		for {
+			// an empty leak set only has to stay empty, so settling
+			// may finish after the context is done
+			done := ctx.Done()
+			if clean > 0 || grace != nil {
+				done = nil
+			}
 			select {
 			case <-ticker.C:
-				if leaked, ok = leakedGoroutines(orig, interestingGoroutines(t)); ok {
-					return
+				if poll() {
+					if clean++; clean >= o.settleChecks {
+						passed()
+						return
+					}
+				} else {
+					clean = 0
 				}
 				continue
-			case <-ctx.Done():
-				t.Errorf("leaktest: %v", ctx.Err())
+			case <-done:
+				if full() {
+					passed()
+					return
+				}
+				// slow DNS lookups get their own grace period
+				if grace = o.resolverGraceTimer(leaked); grace != nil {
+					continue
+				}
+			case <-grace:
+				if full() {
+					passed()
+					return
+				}
 			}
 			break
 		}
 
-		for _, g := range leaked {
-			t.Errorf("leaktest: leaked goroutine: %v", g)
+		leaked = o.confirm(leaked, func() []*Goroutine {
+			gs, _ := leakedGoroutines(o, orig, capture())
+			return gs
+		})
+		if len(leaked) == 0 {
+			passed()
+			return
+		}
+		o.sockets = newSockets(orig.sockets)
+		if leaked = o.downgrade(t, leaked); len(leaked) == 0 {
+			return
+		}
+		if o.dryRun {
+			o.sink(MonitorReport{Test: o.testName, Cause: timeoutCause(ctx), Goroutines: len(last), Leaked: leaked})
+			return
+		}
+		o.repeats = o.recordReported(t, leaked)
+		groups := o.leakGroups(leaked)
+		for _, gr := range groups {
+			gr.owner = o.owner(gr.goroutines[0])
+			gr.repeats = o.repeats[gr.goroutines[0].ID]
+		}
+		if o.formatter != nil {
+			r := newLeakReport(o, timeoutCause(ctx), orig.gs, last, peak, leaked)
+			r.Timeline = checkpoints
+			t.Errorf("%s", o.formatter.Format(r))
+		} else {
+			t.Errorf("leaktest: %v, still waiting on %d goroutine(s), peaked at %s goroutines during test:\n%s%s",
+				timeoutCause(ctx), len(leaked), formatCount(peak), formatDelta(orig.gs, last, groups), formatTimeline(checkpoints))
+		}
+		if o.chaos {
+			logf(t, "leaktest: chaos seed %d, replay with goleaker.WithReplaySeed(%d) or %s=%d",
+				o.chaosSeed, o.chaosSeed, ReplaySeedEnv, o.chaosSeed)
+		}
+		recordAttrs(t, groups)
+		for _, fn := range o.onLeak {
+			fn(leaked)
+		}
+		reportExpired(t, o, leaked)
+		if o.formatter == nil {
+			reportLeaks(t, o, leaked)
 		}
+		o.dumpFlightRecorder(t)
+		o.writeFailureArtifact(t, orig, leaked)
 	}
 }
@@ -0,0 +1,130 @@
+// Package lifecycle tracks the background goroutines of long-lived
+// components, so tests can assert that shutting a service down stopped
+// every one of them:
+//
+//	lifecycle.Spawn("flusher", f.run, f.close)
+//	...
+//	lifecycle.Stop(ctx)
+//	lifecycle.VerifyStopped(t)
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// Grace is how long VerifyStopped waits for components to stop.
+var Grace = time.Second
+
+type component struct {
+	name string
+	stop func()
+	id   uint64
+	done chan struct{}
+}
+
+var registry struct {
+	sync.Mutex
+	components []*component
+}
+
+// Spawn runs run in a new goroutine as the component name. stop asks run
+// to return; it is called by Stop.
+func Spawn(name string, run, stop func()) {
+	c := &component{name: name, stop: stop, done: make(chan struct{})}
+	started := make(chan struct{})
+	goleaker.Go(context.Background(), func(context.Context) {
+		defer close(c.done)
+		c.id = goleaker.CurrentGoroutineID()
+		close(started)
+		run()
+	})
+	<-started
+	registry.Lock()
+	registry.components = append(registry.components, c)
+	registry.Unlock()
+}
+
+// running removes the stopped components from the registry and returns
+// the others.
+func running() []*component {
+	registry.Lock()
+	defer registry.Unlock()
+	var cs []*component
+	for _, c := range registry.components {
+		select {
+		case <-c.done:
+		default:
+			cs = append(cs, c)
+		}
+	}
+	registry.components = cs
+	return cs[:len(cs):len(cs)]
+}
+
+// Stop calls the stop function of every running component, the last
+// spawned first, and waits for them to return until ctx is done.
+func Stop(ctx context.Context) error {
+	cs := running()
+	for i := len(cs) - 1; i >= 0; i-- {
+		if cs[i].stop != nil {
+			cs[i].stop()
+		}
+	}
+	for _, c := range cs {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return fmt.Errorf("lifecycle: stopping %s: %w", c.name, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// VerifyStopped waits up to Grace for every spawned component to stop and
+// reports the ones still running along with their stacks, as
+// goleaker.ReportFinding does with opts.
+func VerifyStopped(t goleaker.ErrorReporter, opts ...goleaker.Option) {
+	timer := time.NewTimer(Grace)
+	defer timer.Stop()
+	var stuck []*component
+	expired := false
+	for _, c := range running() {
+		if !expired {
+			select {
+			case <-c.done:
+				continue
+			case <-timer.C:
+				expired = true
+			}
+		}
+		select {
+		case <-c.done:
+		default:
+			stuck = append(stuck, c)
+		}
+	}
+	if len(stuck) == 0 {
+		return
+	}
+	gs, _ := goleaker.RuntimeSource().Capture()
+	stacks := map[uint64]string{}
+	for _, g := range gs {
+		stacks[g.ID] = g.Stack
+	}
+	for _, c := range stuck {
+		stack := strings.TrimSpace(stacks[c.id])
+		if stack == "" {
+			stack = fmt.Sprintf("goroutine %d", c.id)
+		}
+		goleaker.ReportFinding(t, goleaker.Finding{
+			Kind:    "component",
+			Message: fmt.Sprintf("component %s is still running:\n%s", c.name, stack),
+		}, opts...)
+	}
+}
@@ -0,0 +1,92 @@
+package goleaker
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Checkpoint is the number of goroutines at a point of a test named with
+// Mark.
+type Checkpoint struct {
+	Name       string    `json:"name"`
+	Time       time.Time `json:"time"`
+	Goroutines int       `json:"goroutines"`
+}
+
+// timelines maps the names of the tests running a check to their
+// checkpoints.
+var timelines sync.Map
+
+type timeline struct {
+	mu          sync.Mutex
+	checkpoints []Checkpoint
+}
+
+// Mark records the number of goroutines running now under name, e.g.
+// "after server start". When the check of the test finds leaks, its report
+// includes a timeline of the counts at every mark since it began, to show
+// where the goroutines piled up. t has to be a testing.TB; marks outside
+// of a check are dropped.
+func Mark(t ErrorReporter, name string) {
+	v, ok := timelines.Load(testName(t))
+	if !ok {
+		return
+	}
+	tl := v.(*timeline)
+	tl.mu.Lock()
+	tl.checkpoints = append(tl.checkpoints, Checkpoint{Name: name, Time: time.Now(), Goroutines: runtime.NumGoroutine()})
+	tl.mu.Unlock()
+}
+
+// startTimeline begins the timeline of the check of the test, whose
+// baseline of total goroutines was taken at start.
+func startTimeline(test string, start time.Time, total int) {
+	if test == "" {
+		return
+	}
+	timelines.Store(test, &timeline{checkpoints: []Checkpoint{{Name: "check began", Time: start, Goroutines: total}}})
+}
+
+// endTimeline ends the timeline of the check of the test as the test
+// ends, and returns its checkpoints, nil when the test made no marks.
+func endTimeline(test string) []Checkpoint {
+	v, ok := timelines.LoadAndDelete(test)
+	if !ok {
+		return nil
+	}
+	tl := v.(*timeline)
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if len(tl.checkpoints) < 2 {
+		return nil
+	}
+	return append(tl.checkpoints, Checkpoint{Name: "test ended", Time: time.Now(), Goroutines: runtime.NumGoroutine()})
+}
+
+// formatTimeline renders checkpoints as a table of the time since the
+// first one, the name and the count with its change.
+func formatTimeline(checkpoints []Checkpoint) string {
+	if len(checkpoints) == 0 {
+		return ""
+	}
+	var table strings.Builder
+	tw := tabwriter.NewWriter(&table, 0, 8, 2, ' ', 0)
+	for i, c := range checkpoints {
+		delta := ""
+		if i > 0 {
+			delta = fmt.Sprintf(" (%+d)", c.Goroutines-checkpoints[i-1].Goroutines)
+		}
+		fmt.Fprintf(tw, "+%v\t%s\t%s goroutines%s\n",
+			c.Time.Sub(checkpoints[0].Time).Round(time.Millisecond), c.Name, formatCount(c.Goroutines), delta)
+	}
+	tw.Flush()
+	b := "\n\ttimeline:"
+	for _, line := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+		b += "\n\t  " + line
+	}
+	return b
+}
@@ -0,0 +1,225 @@
+package goleaker
+
+import (
+	"strings"
+	"time"
+)
+
+// Matcher selects goroutines, for ignore rules as well as rules about
+// goroutines that must be gone by the end of a check.
+type Matcher func(g *Goroutine) bool
+
+// And matches goroutines matched by all of ms.
+func And(ms ...Matcher) Matcher {
+	return func(g *Goroutine) bool {
+		for _, m := range ms {
+			if !m(g) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches goroutines matched by any of ms.
+func Or(ms ...Matcher) Matcher {
+	return func(g *Goroutine) bool {
+		for _, m := range ms {
+			if m(g) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches goroutines not matched by m.
+func Not(m Matcher) Matcher {
+	return func(g *Goroutine) bool {
+		return !m(g)
+	}
+}
+
+// TopFunc matches goroutines whose topmost frame is in the function fn,
+// e.g. "time.Sleep".
+func TopFunc(fn string) Matcher {
+	return func(g *Goroutine) bool {
+		return len(g.Frames) > 0 && g.Frames[0].Func == fn
+	}
+}
+
+// AnyFrame matches goroutines with a frame in the function fn.
+func AnyFrame(fn string) Matcher {
+	return func(g *Goroutine) bool {
+		for _, f := range g.Frames {
+			if f.Func == fn {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// CreatedBy matches goroutines started by the function fn.
+func CreatedBy(fn string) Matcher {
+	return func(g *Goroutine) bool {
+		return g.CreatedBy == fn
+	}
+}
+
+// State matches goroutines with the wait reason state, e.g.
+// "chan receive" or "select".
+func State(state string) Matcher {
+	return func(g *Goroutine) bool {
+		return g.State == state
+	}
+}
+
+// MinAge matches goroutines that have existed for at least d according to
+// their CreatedLabel, or else have been waiting for at least d, which the
+// runtime only reports in whole minutes.
+func MinAge(d time.Duration) Matcher {
+	return func(g *Goroutine) bool {
+		if age, ok := g.Age(); ok {
+			return age >= d
+		}
+		return g.Wait >= d
+	}
+}
+
+// SignatureID matches goroutines whose SignatureID starts with one of ids,
+// so an abbreviated ID like "9f3a1c" is enough.
+func SignatureID(ids ...string) Matcher {
+	return func(g *Goroutine) bool {
+		id := g.SignatureID()
+		for _, prefix := range ids {
+			if prefix != "" && strings.HasPrefix(id, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Ignore ignores goroutines matched by any of ms.
+func Ignore(ms ...Matcher) Option {
+	return func(o *options) {
+		o.ignores = append(o.ignores, ms...)
+	}
+}
+
+// IgnoreGoroutineIDs ignores exactly the goroutines with one of ids, such
+// as a long-lived helper which reported its CurrentGoroutineID.
+func IgnoreGoroutineIDs(ids ...uint64) Option {
+	set := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return Ignore(func(g *Goroutine) bool {
+		return set[g.ID]
+	})
+}
+
+// RequireGone always reports goroutines matched by any of ms, even those
+// an ignore rule or the built-in ignores would skip.
+func RequireGone(ms ...Matcher) Option {
+	return func(o *options) {
+		o.requires = append(o.requires, ms...)
+	}
+}
+
+// Suppression records why a known leak is ignored and until when.
+type Suppression struct {
+	// Owner is who is fixing the leak.
+	Owner string
+	// Ticket references the issue tracking the fix, e.g. "JIRA-123".
+	Ticket string
+	// Expires is when the suppression stops ignoring the leak; zero
+	// means never.
+	Expires time.Time
+}
+
+func (s Suppression) expired(now time.Time) bool {
+	return !s.Expires.IsZero() && !now.Before(s.Expires)
+}
+
+func (s Suppression) String() string {
+	name := s.Ticket
+	if name == "" {
+		name = "leak"
+	}
+	if s.Owner != "" {
+		name += " (owner " + s.Owner + ")"
+	}
+	return name
+}
+
+// Suppress ignores goroutines matched by any of ms until s expires. Once
+// it has, the goroutines are reported again along with the expired
+// suppression, so a known leak cannot be snoozed forever.
+func Suppress(s Suppression, ms ...Matcher) Option {
+	m := Or(ms...)
+	return func(o *options) {
+		o.suppressions = append(o.suppressions, suppression{Suppression: s, m: m})
+		o.ignores = append(o.ignores, func(g *Goroutine) bool {
+			return !s.expired(time.Now()) && m(g)
+		})
+	}
+}
+
+type suppression struct {
+	Suppression
+	m Matcher
+}
+
+var globalIgnores []Matcher
+
+// AddIgnore ignores goroutines matched by m in every check.
+func AddIgnore(m Matcher) {
+	globalIgnores = append(globalIgnores, m)
+}
+
+// AddFilter ignores goroutines whose stack, without the header line,
+// makes fn return true in every check.
+//
+// Deprecated: use AddIgnore or Ignore with a Matcher.
+func AddFilter(fn func(string) bool) {
+	AddIgnore(func(g *Goroutine) bool {
+		return fn(g.body())
+	})
+}
+
+// funcPrefix matches goroutines with a frame or creation frame starting
+// with one of the prefixes.
+func funcPrefix(prefixes ...string) Matcher {
+	return func(g *Goroutine) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(g.CreatedBy, prefix) {
+				return true
+			}
+			for _, f := range g.Frames {
+				if strings.HasPrefix(f.Func, prefix) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// createdInPackage matches goroutines whose creation frame's import path
+// matches one of the patterns, see IgnorePackages.
+func createdInPackage(patterns ...string) Matcher {
+	return func(g *Goroutine) bool {
+		if g.CreatedBy == "" {
+			return false
+		}
+		pkg := funcPackage(g.CreatedBy)
+		for _, pattern := range patterns {
+			if matchPackage(pattern, pkg) {
+				return true
+			}
+		}
+		return false
+	}
+}
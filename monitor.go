@@ -0,0 +1,402 @@
+package goleaker
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMonitorInterval is how often a Monitor captures goroutines unless
+// WithMonitorInterval says otherwise.
+var DefaultMonitorInterval = time.Minute
+
+// MonitorReport is what a Monitor hands to its sinks.
+type MonitorReport struct {
+	// Time is when the goroutines were captured.
+	Time time.Time
+	// Test is the name of the test whose check found the leaks in
+	// WithDryRun mode, empty for a Monitor, and Cause the summary of the
+	// check.
+	Test, Cause string
+	// Goroutines is the number of goroutines considered.
+	Goroutines int
+	// Leaked are the goroutines started since the baseline, only those of
+	// the growing signatures when a GrowthPolicy is set.
+	Leaked []*Goroutine
+	// Growing are the signatures alerted on by the GrowthPolicy.
+	Growing []Growth
+	// Metrics are the runtime metrics sampled with the goroutines.
+	Metrics RuntimeMetrics
+	// Incidents are the incidents of WithAlertDedup alerted on, those of
+	// the signatures of Leaked, and Resolved the incidents resolved since
+	// the last report.
+	Incidents, Resolved []Incident
+	// Findings are the leaks other than of goroutines found by a check in
+	// WithDryRun mode.
+	Findings []Finding
+}
+
+// Sink receives the reports of a Monitor.
+type Sink interface {
+	Report(r MonitorReport)
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(r MonitorReport)
+
+// Report calls f(r).
+func (f SinkFunc) Report(r MonitorReport) { f(r) }
+
+// logSink writes reports with the standard logger.
+type logSink struct{}
+
+func (logSink) Report(r MonitorReport) {
+	log.Print(monitorSummary(r, groupGoroutines(r.Leaked)))
+}
+
+// monitorSummary describes a report in a few lines of text.
+func monitorSummary(r MonitorReport, groups []*group) string {
+	var b strings.Builder
+	line := func() {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+	}
+	prefix := "goleaker: "
+	if r.Test != "" {
+		prefix += r.Test + ": "
+	}
+	for _, f := range r.Findings {
+		line()
+		fmt.Fprintf(&b, "%s%s", prefix, f)
+	}
+	if len(r.Leaked) > 0 || len(r.Resolved)+len(r.Findings) == 0 {
+		line()
+		switch {
+		case r.Cause != "":
+			fmt.Fprintf(&b, "%s%s, %d goroutine(s) leaked:\n%s", prefix, r.Cause, len(r.Leaked), formatGroups(groups))
+		case r.Test != "":
+			fmt.Fprintf(&b, "%s%d goroutine(s) leaked:\n%s", prefix, len(r.Leaked), formatGroups(groups))
+		case r.Metrics == RuntimeMetrics{}:
+			// checks in dry run mode do not sample the runtime
+			fmt.Fprintf(&b, "goleaker: %d goroutine(s) leaked:\n%s", len(r.Leaked), formatGroups(groups))
+		default:
+			fmt.Fprintf(&b, "goleaker: %d goroutine(s) started since the baseline, runtime: %s:\n%s",
+				len(r.Leaked), r.Metrics, formatGroups(groups))
+		}
+	}
+	if len(r.Resolved) > 0 {
+		line()
+		fmt.Fprintf(&b, "goleaker: %d incident(s) resolved:", len(r.Resolved))
+		for _, inc := range r.Resolved {
+			fmt.Fprintf(&b, "\n\tincident %s, sig %s, open for %s", inc.Fingerprint, inc.ID, inc.Resolved.Sub(inc.Opened).Round(time.Second))
+		}
+	}
+	return b.String()
+}
+
+// WithMonitorInterval sets how often a Monitor captures goroutines.
+func WithMonitorInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.monitorInterval = d
+	}
+}
+
+// WithSink adds a sink for Monitor reports. Without any sink reports are
+// written with the standard logger.
+func WithSink(s Sink) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, s)
+	}
+}
+
+// WithConfigFile makes a Monitor load its rules from path and reload them
+// whenever the file changes, so operators can silence a known leak while
+// a fix rolls out without restarting the process.
+func WithConfigFile(path string) Option {
+	return func(o *options) {
+		o.configFile = path
+	}
+}
+
+// WithAutoBaseline makes a Monitor take its baseline once the number of
+// goroutines has not changed for window, polled every monitor interval,
+// instead of when it starts, so it does not have to be started once the
+// process is known to be warmed up. It waits for the WithWarmup period
+// first, if one is set.
+func WithAutoBaseline(window time.Duration) Option {
+	return func(o *options) {
+		o.autoBaseline = window
+	}
+}
+
+// Monitor is a production watchdog: it periodically captures the
+// goroutines of the running process and reports the ones started since
+// its baseline to its sinks.
+type Monitor struct {
+	opts []Option
+
+	mu        sync.Mutex
+	o         *options
+	configMod time.Time
+	baseline  baseline
+	reported  map[uint64]bool
+	last      MonitorReport
+	growth    growthTracker
+	incidents incidentTracker
+	metrics   metricsSampler
+	history   snapshotRing
+	unhealthy bool
+	started   bool
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewMonitor returns a Monitor configured by opts. Call Start to take the
+// baseline and begin monitoring.
+func NewMonitor(opts ...Option) *Monitor {
+	// the monitor's own goroutines are not leaks
+	opts = append([]Option{Ignore(funcPrefix(selfPackage + ".(*Monitor)."))}, opts...)
+	m := &Monitor{
+		opts: opts,
+		o:    newOptions(opts),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := m.Reload(); err != nil {
+		log.Printf("goleaker: %s", err)
+	}
+	return m
+}
+
+// Start takes the baseline and starts monitoring in a new goroutine, once
+// the WithWarmup period is over if one is set, and once the goroutines
+// settled with WithAutoBaseline. A Monitor can only be started once.
+func (m *Monitor) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started {
+		return
+	}
+	m.started = true
+	if m.o.warmup <= 0 && m.o.autoBaseline <= 0 {
+		m.baseline = takeBaseline(logReporter{}, m.o)
+	}
+	interval := m.o.monitorInterval
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+	go m.run(interval, m.o.warmup, m.o.autoBaseline)
+}
+
+// Stop stops monitoring and waits for the monitor goroutine to exit.
+func (m *Monitor) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	m.mu.Lock()
+	started := m.started
+	m.mu.Unlock()
+	if started {
+		<-m.done
+	}
+}
+
+// Reload reloads the rules from the file given with WithConfigFile. On
+// error the current rules stay in effect.
+func (m *Monitor) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reload(true)
+}
+
+// ReloadOnSignal reloads the rules whenever one of sigs, e.g.
+// syscall.SIGHUP, is received, until the Monitor is stopped.
+func (m *Monitor) ReloadOnSignal(sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				if err := m.Reload(); err != nil {
+					log.Printf("goleaker: %s", err)
+				}
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// reload rebuilds the options, reading the config file if it changed or
+// force is set. m.mu must be held.
+func (m *Monitor) reload(force bool) error {
+	path := m.o.configFile
+	if path == "" {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !force && fi.ModTime().Equal(m.configMod) {
+		return nil
+	}
+	m.configMod = fi.ModTime()
+	c, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	m.o = newOptions(append(m.opts[:len(m.opts):len(m.opts)], c.Option()))
+	return nil
+}
+
+func (m *Monitor) run(interval, warmup, settle time.Duration) {
+	defer close(m.done)
+	if warmup > 0 {
+		timer := time.NewTimer(warmup)
+		select {
+		case <-timer.C:
+		case <-m.stop:
+			timer.Stop()
+			return
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	if settle > 0 && !m.settle(ticker.C, settle) {
+		return
+	}
+	if warmup > 0 || settle > 0 {
+		m.mu.Lock()
+		m.baseline = takeBaseline(logReporter{}, m.o)
+		m.mu.Unlock()
+	}
+	for {
+		select {
+		case <-ticker.C:
+			m.tick()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// settle waits for the number of goroutines to stay the same for window,
+// counting them on every tick. It returns false if the Monitor was stopped
+// first.
+func (m *Monitor) settle(tick <-chan time.Time, window time.Duration) bool {
+	count := func() int {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.capture())
+	}
+	n, since := count(), time.Now()
+	for {
+		select {
+		case now := <-tick:
+			if c := count(); c != n {
+				n, since = c, now
+			} else if now.Sub(since) >= window {
+				return true
+			}
+		case <-m.stop:
+			return false
+		}
+	}
+}
+
+// tick captures the goroutines once and reports any new leaks.
+func (m *Monitor) tick() {
+	m.mu.Lock()
+	if err := m.reload(false); err != nil {
+		log.Printf("goleaker: %s", err)
+	}
+	gs := m.capture()
+	var leaked []*Goroutine
+	fresh := false
+	for _, g := range gs {
+		if m.baseline.contains(g) {
+			continue
+		}
+		leaked = append(leaked, g)
+	}
+	leaked = m.o.withinBudget(leaked)
+	reported := make(map[uint64]bool, len(leaked))
+	for _, g := range leaked {
+		reported[g.ID] = true
+		fresh = fresh || !m.reported[g.ID]
+	}
+	m.reported = reported
+	r := MonitorReport{Time: time.Now(), Goroutines: len(gs), Leaked: leaked, Metrics: m.metrics.sample()}
+	m.last = r
+	groups := groupGoroutines(leaked)
+	m.history.add(m.o.history, m.o.memoryLimit, r.Time, r.Goroutines, groups)
+	if p := m.o.growth; p != nil {
+		r.Growing = m.growth.observe(p, r.Time, groups)
+		growing := map[string]bool{}
+		for _, g := range r.Growing {
+			growing[g.Signature] = true
+		}
+		r.Leaked = nil
+		for _, gr := range groups {
+			if growing[gr.sig] {
+				r.Leaked = append(r.Leaked, gr.goroutines...)
+			}
+		}
+		fresh = len(r.Growing) > 0
+	}
+	if w := m.o.alertDedup; w > 0 {
+		leaking := groups
+		if m.o.growth != nil {
+			leaking = nil
+			for _, gr := range groups {
+				if h := m.growth.sigs[gr.sig]; h != nil && h.growing {
+					leaking = append(leaking, gr)
+				}
+			}
+		}
+		r.Incidents, r.Resolved = m.incidents.observe(w, r.Time, leaking)
+		alerted := map[string]bool{}
+		for _, inc := range r.Incidents {
+			alerted[inc.ID] = true
+		}
+		r.Leaked = nil
+		for _, gr := range leaking {
+			if alerted[gr.id] {
+				r.Leaked = append(r.Leaked, gr.goroutines...)
+			}
+		}
+		fresh = len(r.Incidents)+len(r.Resolved) > 0
+	}
+	sinks := m.o.sinks
+	m.mu.Unlock()
+
+	if !fresh {
+		return
+	}
+	if len(sinks) == 0 {
+		sinks = []Sink{logSink{}}
+	}
+	for _, s := range sinks {
+		s.Report(r)
+	}
+}
+
+// capture returns the interesting goroutines. m.mu must be held.
+func (m *Monitor) capture() []*Goroutine {
+	return interestingGoroutines(logReporter{}, m.o)
+}
+
+// logReporter reports errors with the standard logger.
+type logReporter struct{}
+
+func (logReporter) Errorf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
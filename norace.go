@@ -0,0 +1,5 @@
+//go:build !race
+
+package goleaker
+
+const raceEnabled = false
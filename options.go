@@ -0,0 +1,271 @@
+package goleaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Option configures a single leak check.
+type Option func(*options)
+
+type options struct {
+	source Source
+
+	ignores      []Matcher
+	requires     []Matcher
+	only         []Matcher
+	suppressions []suppression
+	budgets      []budget
+
+	configErr error
+
+	monitorInterval time.Duration
+	configFile      string
+	sinks           []Sink
+	healthThreshold int
+	growth          *GrowthPolicy
+	alertDedup      time.Duration
+	history         int
+	memoryLimit     int
+	autoBaseline    time.Duration
+
+	requireCreatedInTest bool
+	testFunc             string
+	testName             string
+	attribute            bool
+
+	settleChecks   int
+	settleInterval time.Duration
+	confirmations  int
+
+	sampling bool
+
+	soakLimits *SoakLimits
+	caches     []observedCache
+	warmup     time.Duration
+
+	flakeFile       string
+	flakeQuarantine bool
+	flaky           map[uint64]bool
+	sleepers        sleepLoops
+	quarantineFile  string
+	dedup           bool
+	dedupFile       string
+	repeats         map[uint64]int
+	sockets         []socket
+
+	warns      []Matcher
+	failAbove  int
+	warnLogger *slog.Logger
+	strict     bool
+	cgo        cgoPolicy
+
+	flightDir    string
+	flightWindow time.Duration
+	recorder     *flightRecorder
+
+	exitReport      string
+	exitSignals     bool
+	sharedSignals   bool
+	failureArtifact string
+
+	skipOnFailed bool
+	beforeCheck  []func()
+	onLeak       []func(leaked []*Goroutine)
+	noBaseline   bool
+	formatter    Formatter
+	chaos        bool
+	chaosSeed    int64
+	replaySeed   *int64
+	dryRun       bool
+	owners       owners
+	blame        BlameProvider
+
+	hasTimeout    bool
+	timeout       time.Duration
+	deadline      time.Time
+	binaryStart   time.Time
+	resolverGrace time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{source: RuntimeSource()}
+	if opt := discoveredConfig(); opt != nil {
+		opt(o)
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	dryRunFromEnv(o)
+	return o
+}
+
+// IgnorePackages ignores goroutines whose creation frame belongs to one of
+// the given import paths. A pattern ending in "/..." matches the package and
+// every package below it, e.g. "google.golang.org/grpc/...". Patterns are
+// matched with path.Match, so "github.com/*/client" works as well.
+func IgnorePackages(patterns ...string) Option {
+	return func(o *options) {
+		o.ignores = append(o.ignores, createdInPackage(patterns...))
+	}
+}
+
+// RequireCreatedInTest only reports goroutines whose stack passes through
+// the test function that called Check, either in their own frames, their
+// creation frame or (with GODEBUG=tracebackancestors) their ancestors.
+// Goroutines started indirectly by other code are not reported, trading
+// missed leaks for near-zero false positives. It has no effect outside of
+// a test.
+func RequireCreatedInTest() Option {
+	return func(o *options) {
+		o.requireCreatedInTest = true
+	}
+}
+
+// WithSettleChecks requires the leak set to be empty for n consecutive
+// polls, taken interval apart, before the check passes. This avoids
+// flaky passes when a goroutine is momentarily missed by one capture.
+// A non-positive interval keeps the default ticker interval.
+func WithSettleChecks(n int, interval time.Duration) Option {
+	return func(o *options) {
+		o.settleChecks = n
+		o.settleInterval = interval
+	}
+}
+
+// WithSkipOnFailed skips the leak check when the test has already failed,
+// so the real failure is not buried under leak reports from goroutines
+// the failing code left behind. It requires the ErrorReporter to have a
+// Failed() bool method, as *testing.T does.
+func WithSkipOnFailed() Option {
+	return func(o *options) {
+		o.skipOnFailed = true
+	}
+}
+
+// WithGCBeforeCheck runs the garbage collector and yields to pending
+// finalizers n times before comparing goroutines, since many apparent
+// leaks are goroutines a finalizer would release.
+func WithGCBeforeCheck(n int) Option {
+	return func(o *options) {
+		o.beforeCheck = append(o.beforeCheck, func() {
+			for i := 0; i < n; i++ {
+				runtime.GC()
+				runtime.Gosched()
+			}
+		})
+	}
+}
+
+// WithTimeout sets how long a check waits for goroutines to exit, as the
+// timeout of CheckTimeout does. The timeout of CheckTimeout takes
+// precedence. Unlike the default grace periods, neither is scaled by
+// TimeScale or RaceTimeScale.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.hasTimeout = true
+		o.timeout = d
+	}
+}
+
+// TestDeadlineMargin is the time WithTestDeadline leaves between the end of
+// the grace period and the test binary's deadline, so there is still time
+// to report the leak before the testing package panics.
+var TestDeadlineMargin = time.Second
+
+// WithTestDeadline ends the grace period TestDeadlineMargin before the
+// deadline reported by t, which is usually a *testing.T, so a check never
+// pushes a test past the go test -timeout boundary. It has no effect when
+// the test has no deadline.
+func WithTestDeadline(t interface{ Deadline() (time.Time, bool) }) Option {
+	return func(o *options) {
+		if d, ok := t.Deadline(); ok {
+			o.deadline = d.Add(-TestDeadlineMargin)
+		}
+	}
+}
+
+// graceContext derives the context bounding the grace period from ctx,
+// starting the configured timeout now.
+func (o *options) graceContext(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	var timers []*time.Timer
+	after := func(d time.Duration, cause error) {
+		if d <= 0 {
+			cancel(cause)
+			return
+		}
+		timers = append(timers, time.AfterFunc(d, func() { cancel(cause) }))
+	}
+	if o.hasTimeout {
+		if o.timeout <= 0 {
+			after(0, errors.New("no grace period"))
+		} else {
+			after(o.timeout, fmt.Errorf("timed out after %v", o.timeout))
+		}
+	}
+	if !o.deadline.IsZero() {
+		after(time.Until(o.deadline), errors.New("test deadline is near"))
+	}
+	if !o.binaryStart.IsZero() {
+		if d, ok := binaryDeadline(o.binaryStart); ok {
+			after(time.Until(d), errors.New("-test.timeout is near, reporting early"))
+		}
+	}
+	return ctx, func() {
+		// Remember to clean up the timers and context
+		for _, timer := range timers {
+			timer.Stop()
+		}
+		cancel(nil)
+	}
+}
+
+func (o *options) pollInterval() time.Duration {
+	if o.settleInterval > 0 {
+		return o.settleInterval
+	}
+	return scaled(tickerInterval)
+}
+
+// ignored reports whether g is excluded by the options.
+func (o *options) ignored(g *Goroutine) bool {
+	if o.testFunc != "" && !passesThrough(g.Stack, o.testFunc) {
+		return true
+	}
+	if len(o.only) > 0 && !Or(o.only...)(g) {
+		return true
+	}
+	return Or(globalIgnores...)(g) || Or(o.ignores...)(g)
+}
+
+// required reports whether g must be gone by the end of the check,
+// regardless of any ignore rule.
+func (o *options) required(g *Goroutine) bool {
+	return Or(o.requires...)(g)
+}
+
+// matchPackage reports whether the import path pkg matches pattern.
+func matchPackage(pattern, pkg string) bool {
+	if !strings.HasSuffix(pattern, "/...") {
+		ok, _ := path.Match(pattern, pkg)
+		return ok
+	}
+	pattern = strings.TrimSuffix(pattern, "/...")
+	for {
+		if ok, _ := path.Match(pattern, pkg); ok {
+			return true
+		}
+		i := strings.LastIndexByte(pkg, '/')
+		if i < 0 {
+			return false
+		}
+		pkg = pkg[:i]
+	}
+}
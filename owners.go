@@ -0,0 +1,162 @@
+package goleaker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// owners maps the code of leaked goroutines to the teams owning it.
+type owners struct {
+	// packages are package patterns and their owners, most specific
+	// first.
+	packages []ownerRule
+	// files are the rules of a CODEOWNERS file, whose last match wins,
+	// relative to root.
+	files []ownerRule
+	root  string
+}
+
+type ownerRule struct {
+	pattern, owner string
+}
+
+// WithOwners names the likely owner of every group of leaked goroutines
+// in reports, e.g. "likely owner: @team-platform". owners maps package
+// patterns, as for IgnorePackages, to owners; the longest pattern matching
+// the package of a frame of the goroutine wins, innermost frame first.
+func WithOwners(owners map[string]string) Option {
+	return func(o *options) {
+		for pattern, owner := range owners {
+			o.owners.packages = append(o.owners.packages, ownerRule{pattern, owner})
+		}
+		sort.SliceStable(o.owners.packages, func(i, j int) bool {
+			a, b := o.owners.packages[i].pattern, o.owners.packages[j].pattern
+			return len(a) > len(b) || len(a) == len(b) && a < b
+		})
+	}
+}
+
+// WithCodeowners is the same as WithOwners, but with the owners of the
+// source files of the frames as set by a CODEOWNERS file. Its patterns
+// are relative to the root of the repository, the parent of the .github,
+// .gitlab or docs directory holding the file or else the directory of the
+// file. Patterns match as in .gitignore files, except for "**". The
+// owners of WithOwners take precedence.
+func WithCodeowners(file string) Option {
+	rules, err := parseCodeowners(file)
+	return func(o *options) {
+		if err != nil {
+			o.configErr = err
+			return
+		}
+		root, _ := filepath.Abs(filepath.Dir(file))
+		switch filepath.Base(root) {
+		case ".github", ".gitlab", "docs":
+			root = filepath.Dir(root)
+		}
+		o.owners.files, o.owners.root = rules, root
+	}
+}
+
+func parseCodeowners(file string) ([]ownerRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ownerRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case strings.HasPrefix(fields[0], "["):
+			// GitLab section headers
+		case len(fields) == 1:
+			// a pattern without owners unsets the owners of earlier rules
+			rules = append(rules, ownerRule{pattern: fields[0]})
+		default:
+			if _, err := path.Match(strings.Trim(fields[0], "/"), ""); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+			}
+			rules = append(rules, ownerRule{fields[0], strings.Join(fields[1:], " ")})
+		}
+	}
+	return rules, sc.Err()
+}
+
+// owner returns the likely owner of g, or "" when none of the rules of o
+// match it.
+func (o *options) owner(g *Goroutine) string {
+	own := &o.owners
+	if len(own.packages) == 0 && len(own.files) == 0 {
+		return ""
+	}
+	for _, f := range g.Frames {
+		if owner := own.lookup(funcPackage(f.Func), f.File); owner != "" {
+			return owner
+		}
+	}
+	if g.CreatedBy != "" {
+		return own.lookup(funcPackage(g.CreatedBy), "")
+	}
+	return ""
+}
+
+func (own *owners) lookup(pkg, file string) string {
+	for _, r := range own.packages {
+		if matchPackage(r.pattern, pkg) {
+			return r.owner
+		}
+	}
+	if file == "" || len(own.files) == 0 {
+		return ""
+	}
+	rel, err := filepath.Rel(own.root, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	rel = filepath.ToSlash(rel)
+	for i := len(own.files) - 1; i >= 0; i-- {
+		if matchCodeowners(own.files[i].pattern, rel) {
+			return own.files[i].owner
+		}
+	}
+	return ""
+}
+
+// matchCodeowners reports whether the CODEOWNERS pattern matches the file
+// at the slash separated path rel, or a directory above it.
+func matchCodeowners(pattern, rel string) bool {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "*" && !anchored {
+		return true
+	}
+	elems := strings.Split(rel, "/")
+	n := strings.Count(pattern, "/") + 1
+	for start := 0; start+n <= len(elems); start++ {
+		if anchored && start > 0 {
+			break
+		}
+		end := start + n
+		if dirOnly && end == len(elems) {
+			// the pattern names a directory, not the file itself
+			continue
+		}
+		if ok, _ := path.Match(pattern, strings.Join(elems[start:end], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
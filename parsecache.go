@@ -0,0 +1,45 @@
+package goleaker
+
+import (
+	"strings"
+	"sync"
+)
+
+// parseCache keeps the goroutines parsed from the previous dump of a
+// process, keyed by their text. Most goroutines are identical from one
+// poll to the next, so only the ones which changed are parsed again.
+type parseCache struct {
+	mu   sync.Mutex
+	buf  []byte
+	prev map[string]cachedGoroutine
+}
+
+type cachedGoroutine struct {
+	// block is the text of the goroutine in its own string, so cached
+	// goroutines do not keep entire dumps alive.
+	block string
+	g     Goroutine
+}
+
+// parse parses dump, reusing the goroutines of the previous dump. c.mu
+// must be held.
+func (c *parseCache) parse(dump string) ([]Goroutine, error) {
+	blocks := dumpBlocks(dump)
+	kept := make([]string, len(blocks))
+	gs, errs := parseBlocks(blocks, func(i int, block string) (Goroutine, error) {
+		if cg, ok := c.prev[block]; ok {
+			kept[i] = cg.block
+			return cg.g, nil
+		}
+		kept[i] = strings.Clone(block)
+		return parseBlock(kept[i])
+	})
+	next := make(map[string]cachedGoroutine, len(gs))
+	for i, block := range kept {
+		if errs[i] == nil {
+			next[block] = cachedGoroutine{block: block, g: gs[i]}
+		}
+	}
+	c.prev = next
+	return compactParsed(gs, errs)
+}
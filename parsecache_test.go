@@ -0,0 +1,66 @@
+package goleaker
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestParseCache(t *testing.T) {
+	c := &parseCache{}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	first := largeDump(3)
+	// the dump lives in a buffer overwritten by the next capture, as with
+	// captureStacks
+	buf := []byte(first)
+	gs1, err := c.parse(unsafe.String(&buf[0], len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(buf, strings.Repeat("x", len(buf)))
+	want, _ := ParseDump(first)
+	if !reflect.DeepEqual(gs1, want) {
+		t.Fatalf("parse =\n%+v\nwant\n%+v", parsedOf(gs1), parsedOf(want))
+	}
+
+	// goroutine 2 changed state and goroutine 3 exited
+	second := strings.Replace(largeDump(2), "goroutine 2 [select]", "goroutine 2 [chan receive]", 1)
+	gs2, err := c.parse(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ = ParseDump(second)
+	if !reflect.DeepEqual(gs2, want) {
+		t.Fatalf("parse =\n%+v\nwant\n%+v", parsedOf(gs2), parsedOf(want))
+	}
+	if &gs2[0].Frames[0] != &gs1[0].Frames[0] {
+		t.Errorf("goroutine 1 did not change but was parsed again")
+	}
+	if &gs2[1].Frames[0] == &gs1[1].Frames[0] {
+		t.Errorf("goroutine 2 changed but was taken from the cache")
+	}
+	if len(c.prev) != 2 {
+		t.Errorf("cache holds %d goroutines, want the 2 of the last dump", len(c.prev))
+	}
+}
+
+func TestParseCacheParallel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	c := &parseCache{}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dump := largeDump(2*parallelBlocks + 1)
+	want, _ := ParseDump(dump)
+	for i := 0; i < 2; i++ {
+		gs, err := c.parse(dump)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gs, want) {
+			t.Fatalf("parse %d differs from ParseDump", i)
+		}
+	}
+}
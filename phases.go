@@ -0,0 +1,68 @@
+package goleaker
+
+import "sync"
+
+// Phases is a check for tests made of many sequential operations, such as
+// table-driven suites, which tells for each leaked signature the phase it
+// first appeared in.
+type Phases struct {
+	t     ErrorReporter
+	o     *options
+	check func()
+
+	mu    sync.Mutex
+	snaps []map[uint64]bool
+}
+
+// CheckPhases starts a check like Check, with phases separated by calls
+// to Phase. The first phase has index 0.
+//
+//	p := goleaker.CheckPhases(t)
+//	defer p.Check()
+//	for _, tc := range cases {
+//		...
+//		p.Phase()
+//	}
+func CheckPhases(t ErrorReporter, opts ...Option) *Phases {
+	p := &Phases{t: t, o: newOptions(opts)}
+	p.check = Check(t, append(opts[:len(opts):len(opts)], onLeak(p.bisect))...)
+	if name := testName(t); name != "" {
+		p.t = namedReporter{ErrorReporter: t, name: name}
+	}
+	return p
+}
+
+// Phase ends the current phase, recording the goroutines running now.
+func (p *Phases) Phase() {
+	ids := map[uint64]bool{}
+	for _, g := range interestingGoroutines(p.t, p.o) {
+		ids[g.ID] = true
+	}
+	p.mu.Lock()
+	p.snaps = append(p.snaps, ids)
+	p.mu.Unlock()
+}
+
+// Check runs the leak check, reporting the phase of every leaked
+// signature along with the leaks.
+func (p *Phases) Check() {
+	p.check()
+}
+
+// bisect reports the first phase each signature of leaked appeared in.
+func (p *Phases) bisect(leaked []*Goroutine) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, gr := range groupGoroutines(leaked) {
+		phase := len(p.snaps)
+		for _, g := range gr.goroutines {
+			for i := 0; i < phase; i++ {
+				if p.snaps[i][g.ID] {
+					phase = i
+					break
+				}
+			}
+		}
+		p.t.Errorf("leaktest: %s first leaked in phase %d", gr.label(), phase)
+	}
+}
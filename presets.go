@@ -0,0 +1,162 @@
+package goleaker
+
+import (
+	"io"
+	"time"
+)
+
+// streamingFuncs are the frame prefixes of websocket and gRPC streaming
+// connections: blocked reads and writes on a connection as well as the
+// reader, writer and keepalive goroutines the libraries start per
+// connection.
+var streamingFuncs = []string{
+	"github.com/gorilla/websocket.",
+	"nhooyr.io/websocket.",
+	"github.com/coder/websocket.",
+	"google.golang.org/grpc/internal/transport.",
+	"google.golang.org/grpc.(*clientStream).",
+	"google.golang.org/grpc.(*serverStream).",
+	"google.golang.org/grpc.(*addrConnStream).",
+	"google.golang.org/grpc.newClientStreamWithParams.",
+}
+
+// IgnoreStreaming ignores goroutines reading, writing or keeping alive
+// gorilla/websocket, nhooyr.io/websocket and gRPC streaming connections.
+func IgnoreStreaming() Option {
+	return ignoreFuncs(streamingFuncs)
+}
+
+// RequireStreamingClosed always reports goroutines of gorilla/websocket,
+// nhooyr.io/websocket and gRPC streaming connections, even those the
+// built-in keepalive ignores or other options would skip, so every stream
+// and connection must be closed by the end of the test.
+func RequireStreamingClosed() Option {
+	return func(o *options) {
+		o.requires = append(o.requires, funcPrefix(streamingFuncs...))
+	}
+}
+
+// resolverFuncs are the frame prefixes of DNS lookups done by the net
+// package, by the pure Go resolver as well as the cgo one.
+var resolverFuncs = []string{
+	"net.(*Resolver).",
+	"net.(*conf).",
+	"net.goLookup",
+	"net.cgoLookup",
+	"net.cgoIPLookup",
+	"net.cgoResSearch",
+	"net.doBlockingWithCtx",
+	"net._C2func_getaddrinfo",
+	"net._Cfunc_getaddrinfo",
+}
+
+// IgnoreResolver ignores goroutines doing DNS lookups in net.Resolver,
+// including the threads of the cgo resolver.
+func IgnoreResolver() Option {
+	return ignoreFuncs(resolverFuncs)
+}
+
+// WithResolverGrace extends the grace period by d when the only
+// goroutines left are DNS lookups, which often outlive a test by a few
+// hundred milliseconds, instead of raising the timeout of the whole check.
+// The extension still ends at the deadline set by WithTestDeadline.
+func WithResolverGrace(d time.Duration) Option {
+	return func(o *options) {
+		o.resolverGrace = d
+	}
+}
+
+// resolverGraceTimer starts the resolver grace period if every goroutine
+// in leaked is a DNS lookup, or returns nil.
+func (o *options) resolverGraceTimer(leaked []*Goroutine) <-chan time.Time {
+	d := o.resolverGrace
+	if !o.deadline.IsZero() {
+		if left := time.Until(o.deadline); left < d {
+			d = left
+		}
+	}
+	if d <= 0 {
+		return nil
+	}
+	for _, g := range leaked {
+		if !funcPrefix(resolverFuncs...)(g) {
+			return nil
+		}
+	}
+	return time.After(d)
+}
+
+// Frame prefixes of the messaging clients with presets. Consumers,
+// producers, heartbeats and reconnect loops all run in these packages.
+var (
+	saramaFuncs = []string{
+		"github.com/IBM/sarama.",
+		"github.com/Shopify/sarama.",
+	}
+	natsFuncs = []string{
+		"github.com/nats-io/nats.go.",
+	}
+	amqpFuncs = []string{
+		"github.com/rabbitmq/amqp091-go.",
+		"github.com/streadway/amqp.",
+	}
+)
+
+// IgnoreSarama ignores the background goroutines of Sarama Kafka clients.
+func IgnoreSarama() Option {
+	return ignoreFuncs(saramaFuncs)
+}
+
+// StrictSarama closes client, a sarama.Client, consumer or producer, when
+// the check runs and then requires every Sarama goroutine to be gone, so
+// consumer, producer and metadata goroutines lingering after Close fail
+// the test even if other options would ignore them.
+func StrictSarama(client interface{}) Option {
+	return strictClient(client, saramaFuncs)
+}
+
+// IgnoreNATS ignores the background goroutines of nats.go connections.
+func IgnoreNATS() Option {
+	return ignoreFuncs(natsFuncs)
+}
+
+// StrictNATS closes conn, a *nats.Conn, when the check runs and then
+// requires every nats.go goroutine to be gone.
+func StrictNATS(conn interface{}) Option {
+	return strictClient(conn, natsFuncs)
+}
+
+// IgnoreAMQP ignores the background goroutines of amqp091-go and
+// streadway/amqp connections.
+func IgnoreAMQP() Option {
+	return ignoreFuncs(amqpFuncs)
+}
+
+// StrictAMQP closes conn, an *amqp.Connection or *amqp.Channel, when the
+// check runs and then requires every AMQP client goroutine to be gone.
+func StrictAMQP(conn interface{}) Option {
+	return strictClient(conn, amqpFuncs)
+}
+
+func ignoreFuncs(prefixes []string) Option {
+	return func(o *options) {
+		o.ignores = append(o.ignores, funcPrefix(prefixes...))
+	}
+}
+
+// strictClient closes client before the check, ignoring the error since
+// it may already have been closed, and requires goroutines matching the
+// prefixes to be gone.
+func strictClient(client interface{}, prefixes []string) Option {
+	return func(o *options) {
+		o.requires = append(o.requires, funcPrefix(prefixes...))
+		o.beforeCheck = append(o.beforeCheck, func() {
+			switch c := client.(type) {
+			case io.Closer:
+				c.Close()
+			case interface{ Close() }:
+				c.Close()
+			}
+		})
+	}
+}
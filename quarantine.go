@@ -0,0 +1,102 @@
+package goleaker
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuarantineEntry tolerates the leaks of a flaky signature for a limited
+// time or number of runs, after which they fail again.
+type QuarantineEntry struct {
+	// Signature is a possibly abbreviated SignatureID.
+	Signature string `json:"signature"`
+	Reason    string `json:"reason,omitempty"`
+	// Expires is the date, such as "2024-06-30", the quarantine ends on.
+	Expires string `json:"expires,omitempty"`
+	// Runs is how many more checks the quarantine tolerates the leaks
+	// for; it is decremented in the file on every one.
+	Runs *int `json:"runs,omitempty"`
+}
+
+// WithQuarantineFile downgrades the leaks of the signatures quarantined in
+// the JSON file at path, a list of QuarantineEntry, to logged warnings
+// until their quarantine ends:
+//
+//	[{"signature": "9f3a1c", "reason": "JIRA-123", "runs": 20}]
+func WithQuarantineFile(path string) Option {
+	return func(o *options) {
+		o.quarantineFile = path
+	}
+}
+
+var quarantineMu sync.Mutex
+
+// quarantined returns the ids of the goroutines in leaked with a
+// signature under quarantine, and reports the quarantines that ended.
+func (o *options) quarantined(t ErrorReporter, leaked []*Goroutine) map[uint64]bool {
+	if o.quarantineFile == "" || len(leaked) == 0 {
+		return nil
+	}
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	var entries []QuarantineEntry
+	data, err := os.ReadFile(o.quarantineFile)
+	if err == nil {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		t.Errorf("leaktest: quarantine: %s", err)
+		return nil
+	}
+	ids := map[uint64]bool{}
+	changed := false
+	for _, gr := range groupGoroutines(leaked) {
+		for i := range entries {
+			e := &entries[i]
+			if e.Signature == "" || !strings.HasPrefix(gr.id, e.Signature) {
+				continue
+			}
+			if ended, why := e.ended(); ended {
+				t.Errorf("leaktest: quarantine of sig %s %s", e.Signature, why)
+				break
+			}
+			if e.Runs != nil {
+				*e.Runs--
+				changed = true
+			}
+			for _, g := range gr.goroutines {
+				ids[g.ID] = true
+			}
+			break
+		}
+	}
+	if changed {
+		if data, err = json.MarshalIndent(entries, "", "  "); err == nil {
+			err = os.WriteFile(o.quarantineFile, data, 0o644)
+		}
+		if err != nil {
+			t.Errorf("leaktest: quarantine: %s", err)
+		}
+	}
+	return ids
+}
+
+// ended reports whether the quarantine is over, and why.
+func (e *QuarantineEntry) ended() (bool, string) {
+	if e.Runs != nil && *e.Runs <= 0 {
+		return true, "ran out of runs"
+	}
+	if e.Expires != "" {
+		expires, err := time.Parse("2006-01-02", e.Expires)
+		if err != nil {
+			return true, "has an invalid expiry: " + err.Error()
+		}
+		if !time.Now().Before(expires) {
+			return true, "expired on " + e.Expires
+		}
+	}
+	return false, ""
+}
@@ -0,0 +1,68 @@
+package goleaker
+
+import (
+	"runtime"
+	"time"
+)
+
+// QuiesceTimeout bounds each of the waits of Quiesce.
+var QuiesceTimeout = 100 * time.Millisecond
+
+// Quiesce brings the process to rest before a capture, in place of the
+// usual sleep before a check: it runs the garbage collector, waits for
+// the finalizers and cleanups it queued to run, yields to the runnable
+// goroutines and waits until the number of goroutines has not changed for
+// a few milliseconds, so goroutines started by timers firing or finalizers
+// and exiting ones have settled. Each wait gives up after QuiesceTimeout.
+// Goroutines still sleeping or blocked are left to the grace period of
+// the check.
+func Quiesce() {
+	// the first cycle queues the finalizers of unreachable objects, the
+	// second frees what they released
+	runtime.GC()
+	runtime.GC()
+	drainFinalizers()
+
+	for i := 0; i < 10; i++ {
+		runtime.Gosched()
+	}
+
+	deadline := time.Now().Add(QuiesceTimeout)
+	n, stable := runtime.NumGoroutine(), 0
+	for stable < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		if m := runtime.NumGoroutine(); m == n {
+			stable++
+		} else {
+			n, stable = m, 0
+		}
+	}
+}
+
+// drainFinalizers waits until a finalizer and a cleanup set now have run,
+// which the runtime does after the ones queued before them.
+func drainFinalizers() {
+	finalized, cleaned := make(chan struct{}), make(chan struct{})
+	func() {
+		f, c := new([16]byte), new([16]byte)
+		runtime.SetFinalizer(f, func(*[16]byte) { close(finalized) })
+		runtime.AddCleanup(c, func(ch chan struct{}) { close(ch) }, cleaned)
+	}()
+	runtime.GC()
+	timer := time.NewTimer(QuiesceTimeout)
+	defer timer.Stop()
+	for _, ch := range []chan struct{}{finalized, cleaned} {
+		select {
+		case <-ch:
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// WithQuiesce runs Quiesce before comparing goroutines.
+func WithQuiesce() Option {
+	return func(o *options) {
+		o.beforeCheck = append(o.beforeCheck, Quiesce)
+	}
+}
@@ -0,0 +1,95 @@
+package goleaker
+
+import "sync"
+
+// recursion holds the options of a CheckRecursive and the goroutines
+// already reported by the checks of its subtests.
+type recursion struct {
+	parent *recursion
+	opts   []Option
+
+	mu       sync.Mutex
+	reported map[uint64]bool
+}
+
+// recursions maps tests to their recursion.
+var recursions sync.Map
+
+func newRecursion(parent *recursion, opts []Option) *recursion {
+	return &recursion{parent: parent, opts: opts, reported: map[uint64]bool{}}
+}
+
+// options returns the options of a check in r.
+func (r *recursion) options() []Option {
+	return append(r.opts[:len(r.opts):len(r.opts)], Ignore(r.wasReported))
+}
+
+func (r *recursion) wasReported(g *Goroutine) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reported[g.ID]
+}
+
+// record marks leaked as reported in r and its ancestors.
+func (r *recursion) record(leaked []*Goroutine) {
+	for ; r != nil; r = r.parent {
+		r.mu.Lock()
+		for _, g := range leaked {
+			r.reported[g.ID] = true
+		}
+		r.mu.Unlock()
+	}
+}
+
+func onLeak(fn func(leaked []*Goroutine)) Option {
+	return func(o *options) {
+		o.onLeak = append(o.onLeak, fn)
+	}
+}
+
+// CheckRecursive is the same as Check, but every subtest of t started
+// with Run is checked on its own with the same options. The check of t
+// only reports the leaks not already reported for a subtest.
+func CheckRecursive(t ErrorReporter, opts ...Option) func() {
+	r := newRecursion(nil, opts)
+	recursions.Store(t, r)
+	check := Check(t, r.options()...)
+	return func() {
+		recursions.Delete(t)
+		check()
+	}
+}
+
+type runner[T any] interface {
+	ErrorReporter
+	Run(name string, fn func(T)) bool
+}
+
+// Run runs fn as the subtest name of t, like t.Run, and checks the
+// subtest for leaks with the options of the enclosing CheckRecursive:
+//
+//	defer goleaker.CheckRecursive(t, goleaker.WithTimeout(time.Second))()
+//	for _, tc := range cases {
+//		goleaker.Run(t, tc.name, func(t *testing.T) {
+//			...
+//		})
+//	}
+//
+// Subtests started with Run from fn are checked the same way.
+func Run[T runner[T]](t T, name string, fn func(T)) bool {
+	var parent *recursion
+	if v, ok := recursions.Load(t); ok {
+		parent = v.(*recursion)
+	}
+	var opts []Option
+	if parent != nil {
+		opts = parent.opts
+	}
+	return t.Run(name, func(sub T) {
+		r := newRecursion(parent, opts)
+		recursions.Store(sub, r)
+		defer recursions.Delete(sub)
+		defer Check(sub, append(r.options(), onLeak(parent.record))...)()
+		fn(sub)
+	})
+}
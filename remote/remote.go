@@ -0,0 +1,145 @@
+// Package remote captures goroutines from live processes over their
+// net/http/pprof endpoint and compares them, e.g. to answer which extra
+// goroutines a canary runs compared to the baseline deployment.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// GoroutinePath is the path of the goroutine profile of net/http/pprof,
+// used when an endpoint has no path.
+const GoroutinePath = "/debug/pprof/goroutine"
+
+// Fetch captures the goroutines of the process serving endpoint, which is
+// either the URL of its goroutine profile or just its address, such as
+// "http://10.0.0.1:6060".
+func Fetch(ctx context.Context, endpoint string) ([]goleaker.Goroutine, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = GoroutinePath
+	}
+	q := u.Query()
+	q.Set("debug", "2")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	dump, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return goleaker.ParseDump(string(dump))
+}
+
+// Source returns a goleaker.Source capturing the goroutines of the
+// process serving endpoint, see Fetch.
+func Source(endpoint string) goleaker.Source {
+	return source(endpoint)
+}
+
+type source string
+
+func (s source) Capture() ([]goleaker.Goroutine, error) {
+	return Fetch(context.Background(), string(s))
+}
+
+// SignatureDiff compares the goroutines of one signature in two processes.
+type SignatureDiff struct {
+	// ID is the goleaker.Goroutine.SignatureID of the signature, which is
+	// stable across builds.
+	ID string
+	// Class is the goleaker.LeakClass of the goroutines.
+	Class goleaker.LeakClass
+	// Top is the topmost function and CreatedBy the creator of the
+	// goroutines.
+	Top, CreatedBy string
+	// Base and Other are the number of goroutines in each process.
+	Base, Other int
+	// Stack is the stack of one of the goroutines.
+	Stack string
+}
+
+// Delta returns how many more goroutines the other process runs.
+func (d SignatureDiff) Delta() int {
+	return d.Other - d.Base
+}
+
+// Diff captures the goroutines of the baseline and other processes and
+// compares them per signature, the largest increase first. Signatures
+// with the same count in both are left out.
+func Diff(ctx context.Context, baseline, other string) ([]SignatureDiff, error) {
+	base, err := Fetch(ctx, baseline)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", baseline, err)
+	}
+	next, err := Fetch(ctx, other)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", other, err)
+	}
+	return DiffGoroutines(base, next), nil
+}
+
+// DiffGoroutines compares two sets of goroutines per signature, as Diff.
+func DiffGoroutines(base, other []goleaker.Goroutine) []SignatureDiff {
+	bySig := map[string]*SignatureDiff{}
+	var diffs []*SignatureDiff
+	count := func(gs []goleaker.Goroutine, n func(d *SignatureDiff) *int) {
+		for i := range gs {
+			g := &gs[i]
+			id := g.SignatureID()
+			d := bySig[id]
+			if d == nil {
+				d = &SignatureDiff{ID: id, Class: g.Class(), CreatedBy: g.CreatedBy, Stack: g.Stack}
+				if len(g.Frames) > 0 {
+					d.Top = g.Frames[0].Func
+				}
+				bySig[id] = d
+				diffs = append(diffs, d)
+			}
+			*n(d)++
+		}
+	}
+	count(base, func(d *SignatureDiff) *int { return &d.Base })
+	count(other, func(d *SignatureDiff) *int { return &d.Other })
+
+	var out []SignatureDiff
+	for _, d := range diffs {
+		if d.Delta() != 0 {
+			out = append(out, *d)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Delta() > out[j].Delta() })
+	return out
+}
+
+// WriteDiff writes diffs as a table.
+func WriteDiff(w io.Writer, diffs []SignatureDiff) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "delta\tbase\tother\tsig\tclass\ttop\tcreated by")
+	for _, d := range diffs {
+		fmt.Fprintf(tw, "%+d\t%d\t%d\t%s\t%s\t%s\t%s\n", d.Delta(), d.Base, d.Other, d.ID, d.Class, d.Top, d.CreatedBy)
+	}
+	return tw.Flush()
+}
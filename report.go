@@ -0,0 +1,269 @@
+package goleaker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// group is a set of goroutines sharing the same normalized stack.
+type group struct {
+	sig        string
+	id         string
+	state      string
+	class      LeakClass
+	top        string
+	kind       string
+	owner      string
+	repeats    int
+	goroutines []*Goroutine
+}
+
+// groupGoroutines groups gs by signature, largest group first.
+func groupGoroutines(gs []*Goroutine) []*group {
+	var groups []*group
+	bySig := map[string]*group{}
+	for _, g := range gs {
+		sig := signature(g.Stack)
+		gr, ok := bySig[sig]
+		if !ok {
+			gr = &group{sig: sig, id: g.SignatureID(), state: g.State, class: g.Class(), kind: leakKind(g)}
+			if fns := stackFuncs(g.Stack); len(fns) > 0 {
+				gr.top = fns[0]
+			}
+			bySig[sig] = gr
+			groups = append(groups, gr)
+		}
+		gr.goroutines = append(gr.goroutines, g)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].goroutines) > len(groups[j].goroutines)
+	})
+	return groups
+}
+
+// formatGroups renders one summary line per group.
+func formatGroups(groups []*group) string {
+	var b strings.Builder
+	for _, gr := range groups {
+		fmt.Fprintf(&b, "\t%d x %s\n", len(gr.goroutines), gr.label())
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// formatDelta renders how the goroutines changed from before to after,
+// "before: N goroutines, after: M (+K new, -J exited)", followed by one
+// line per group of leaked goroutines and per group of the goroutines of
+// before which exited.
+func formatDelta(before, after []*Goroutine, leaked []*group) string {
+	inBefore := make(map[uint64]bool, len(before))
+	for _, g := range before {
+		inBefore[g.ID] = true
+	}
+	inAfter := make(map[uint64]bool, len(after))
+	added := 0
+	for _, g := range after {
+		inAfter[g.ID] = true
+		if !inBefore[g.ID] {
+			added++
+		}
+	}
+	var exited []*Goroutine
+	for _, g := range before {
+		if !inAfter[g.ID] {
+			exited = append(exited, g)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\tbefore: %s goroutines, after: %s (+%d new, -%d exited)\n",
+		formatCount(len(before)), formatCount(len(after)), added, len(exited))
+	for _, gr := range leaked {
+		fmt.Fprintf(&b, "\t+%d x %s\n", len(gr.goroutines), gr.label())
+	}
+	for _, gr := range groupGoroutines(exited) {
+		fmt.Fprintf(&b, "\t-%d x %s\n", len(gr.goroutines), gr.label())
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// label describes where the goroutines of a group are parked.
+func (gr *group) label() string {
+	l := fmt.Sprintf("sig %s %s [%s] %s", gr.id, gr.class, gr.state, gr.top)
+	if created := gr.goroutines[0].CreatedBy; created != "" {
+		l += fmt.Sprintf(" (created by %s)", created)
+	}
+	if gr.kind != "" {
+		l += " stuck in " + gr.kind
+	}
+	if gr.owner != "" {
+		l += ", likely owner: " + gr.owner
+	}
+	if gr.repeats > 0 {
+		l += fmt.Sprintf(", previously reported (x%d)", gr.repeats)
+	}
+	return l
+}
+
+// reportGoroutines reports the goroutines leaked, out of total, under the
+// summary of the check which found them, or hands them to the sinks in
+// dry run mode.
+func reportGoroutines(t ErrorReporter, o *options, summary string, leaked []*Goroutine, total int) {
+	if o.dryRun {
+		o.sink(MonitorReport{Test: o.testName, Cause: summary, Goroutines: total, Leaked: leaked})
+		return
+	}
+	t.Errorf("leaktest: %s:\n%s", summary, formatGroups(groupGoroutines(leaked)))
+	reportLeaks(t, o, leaked)
+}
+
+// reportLeaks reports every leaked goroutine, the ones with a well-known
+// leak kind and likely singletons last and labeled as such.
+func reportLeaks(t ErrorReporter, o *options, leaked []*Goroutine) {
+	frames := o.testFrames()
+	defer frames.close()
+	errorf := func(g *Goroutine, format string, args ...interface{}) {
+		frames.frame(g)
+		t.Errorf(format, args...)
+	}
+	var known, singletons []*Goroutine
+	for _, g := range leaked {
+		if n := o.repeats[g.ID]; n > 0 {
+			errorf(g, "leaktest: leaked goroutine (sig %s, %s), previously reported (x%d)", g.SignatureID(), o.class(g), n)
+			continue
+		}
+		if site, ok := tickerSelect(g); ok {
+			errorf(g, "leaktest: leaked goroutine (%s) selecting only on the time.Ticker created at %s:%d, add defer ticker.Stop() and a ctx.Done() case: %v",
+				o.leakInfo(g), site.File, site.Line, g.Stack)
+			continue
+		}
+		switch {
+		case leakKind(g) != "":
+			known = append(known, g)
+		case o.sleepers.loop(g):
+			errorf(g, "leaktest: leaked goroutine (%s) polling in a time.Sleep loop in %s, likely missing a ctx.Done() check: %v",
+				o.leakInfo(g), sleepCaller(g), g.Stack)
+		case singleton(g):
+			singletons = append(singletons, g)
+		default:
+			errorf(g, "leaktest: leaked goroutine (%s): %v", o.leakInfo(g), g.Stack)
+		}
+	}
+	for _, g := range known {
+		errorf(g, "leaktest: leaked goroutine (%s) stuck in %s: %v", o.leakInfo(g), leakKind(g), g.Stack)
+	}
+	for _, g := range singletons {
+		errorf(g, "leaktest: leaked goroutine (%s), global singleton goroutine — consider ignoring it or an explicit shutdown: %v",
+			o.leakInfo(g), g.Stack)
+	}
+}
+
+// singleton reports whether g was likely started once for the whole
+// process, by a package init function or through sync.Once. The latter
+// only shows up in ancestor tracebacks, see GODEBUG=tracebackancestors.
+func singleton(g *Goroutine) bool {
+	if fn := g.CreatedBy; fn != "" {
+		name := fn[strings.LastIndexByte(fn, '/')+1:]
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[i+1:]
+		}
+		if name == "init" || strings.HasPrefix(name, "init.") {
+			return true
+		}
+	}
+	for _, fn := range stackFuncs(g.Stack) {
+		if strings.HasPrefix(fn, "sync.(*Once).") || strings.HasPrefix(fn, "sync.OnceFunc") || strings.HasPrefix(fn, "sync.OnceValue") {
+			return true
+		}
+	}
+	return false
+}
+
+// leakInfo identifies a leaked goroutine by its signature and, when
+// known, its age and the test that started it.
+func (o *options) leakInfo(g *Goroutine) string {
+	info := "sig " + g.SignatureID() + ", " + string(o.class(g))
+	if age, ok := g.Age(); ok {
+		info += ", age " + age.Round(time.Millisecond).String()
+	}
+	if s := o.blockedSocket(g); s != "" {
+		info += ", " + s
+	}
+	if owner := o.owner(g); owner != "" {
+		info += ", likely owner: " + owner
+	}
+	if b := o.blameOf(g); b != nil {
+		info += ", " + b.String()
+	}
+	if o.flaky[g.ID] {
+		info += ", flaky (quarantined)"
+	}
+	if o.attribute {
+		if name := attributeTest(g); name != "" {
+			info += ", started by " + name
+		}
+	}
+	return info
+}
+
+// reportExpired reports the expired suppressions still matching a leaked
+// goroutine.
+func reportExpired(t ErrorReporter, o *options, leaked []*Goroutine) {
+	now := time.Now()
+	for _, s := range o.suppressions {
+		if !s.expired(now) {
+			continue
+		}
+		for _, g := range leaked {
+			if s.m(g) {
+				t.Errorf("leaktest: suppression for %s expired on %s", s.Suppression, s.Expires.Format("2006-01-02"))
+				break
+			}
+		}
+	}
+}
+
+// leakKind classifies leak signatures that are common and confusing
+// enough to deserve their own label, or returns "".
+func leakKind(g *Goroutine) string {
+	fns := stackFuncs(g.Stack)
+	// a TLS read first has to complete the handshake
+	for _, fn := range fns {
+		if strings.HasPrefix(fn, "crypto/tls.") && strings.Contains(fn, "andshake") {
+			return "TLS handshake"
+		}
+	}
+	for _, fn := range fns {
+		if fn == "crypto/tls.(*Conn).Read" {
+			return "TLS read"
+		}
+	}
+	if entry := cgoEntry(g); entry != "" {
+		return "cgo " + entry
+	}
+	if cgoOpaque(g) {
+		return "C code"
+	}
+	return ""
+}
+
+// formatCount formats n with thousands separators, e.g. "1,204".
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// timeoutCause describes why ctx is done, including its cause when that
+// adds anything to ctx.Err().
+func timeoutCause(ctx context.Context) string {
+	err := ctx.Err()
+	if cause := context.Cause(ctx); cause != nil && cause != err {
+		return fmt.Sprintf("%v (%v)", err, cause)
+	}
+	return err.Error()
+}
@@ -0,0 +1,162 @@
+// Package report compares the leak reports of goleaker, e.g. to tell
+// what changed in the leaks of a service or library since its last
+// release. Reports rendered by goleaker.JSONFormatter are read back with
+// ParseJSON:
+//
+//	base, _ := report.ParseJSON(lastRelease)
+//	next, _ := report.ParseJSON(current)
+//	fmt.Print(report.Diff(base, next))
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// SignatureDelta compares the leaked goroutines of one signature in two
+// reports.
+type SignatureDelta struct {
+	// ID is the goleaker.Goroutine.SignatureID of the signature, which is
+	// stable across builds.
+	ID    string
+	Class goleaker.LeakClass
+	// Top is the topmost function of the goroutines and Owner their
+	// likely owner, if the reports name one.
+	Top, Owner string
+	// Base and Other are the number of goroutines leaked in each report.
+	Base, Other int
+	// Stack is the stack of one of the goroutines.
+	Stack string
+}
+
+// Delta returns how many more goroutines the other report leaks.
+func (d SignatureDelta) Delta() int {
+	return d.Other - d.Base
+}
+
+// ReportDelta is how the leaks changed from one report to another.
+type ReportDelta struct {
+	// New are the signatures only the other report leaks, Fixed those
+	// only the base report leaks and Changed those both leak, in
+	// different numbers. Each is ordered by the size of the change,
+	// largest first.
+	New, Fixed, Changed []SignatureDelta
+}
+
+// Empty reports whether both reports leak the same goroutines.
+func (d ReportDelta) Empty() bool {
+	return len(d.New)+len(d.Fixed)+len(d.Changed) == 0
+}
+
+// String renders the delta as a summary line followed by a table of the
+// signatures, new ones first.
+func (d ReportDelta) String() string {
+	if d.Empty() {
+		return "no change in leaks\n"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d new, %d fixed, %d changed signature(s)\n", len(d.New), len(d.Fixed), len(d.Changed))
+	tw := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "change\tdelta\tbase\tother\tsig\tclass\ttop\towner")
+	for _, part := range []struct {
+		change string
+		deltas []SignatureDelta
+	}{{"new", d.New}, {"fixed", d.Fixed}, {"changed", d.Changed}} {
+		for _, s := range part.deltas {
+			fmt.Fprintf(tw, "%s\t%+d\t%d\t%d\t%s\t%s\t%s\t%s\n", part.change, s.Delta(), s.Base, s.Other, s.ID, s.Class, s.Top, s.Owner)
+		}
+	}
+	tw.Flush()
+	return b.String()
+}
+
+// Diff compares the leaks of the base report a with those of b per
+// signature.
+func Diff(a, b goleaker.LeakReport) ReportDelta {
+	bySig := map[string]*SignatureDelta{}
+	var sigs []*SignatureDelta
+	count := func(leaks []goleaker.Leak, n func(d *SignatureDelta) *int) {
+		for _, l := range leaks {
+			d := bySig[l.Signature]
+			if d == nil {
+				d = &SignatureDelta{ID: l.Signature, Class: l.Class, Owner: l.Owner}
+				if g := l.Goroutine; g != nil {
+					d.Stack = g.Stack
+					if len(g.Frames) > 0 {
+						d.Top = g.Frames[0].Func
+					}
+				}
+				bySig[l.Signature] = d
+				sigs = append(sigs, d)
+			}
+			*n(d)++
+		}
+	}
+	count(a.Leaks, func(d *SignatureDelta) *int { return &d.Base })
+	count(b.Leaks, func(d *SignatureDelta) *int { return &d.Other })
+
+	var delta ReportDelta
+	for _, d := range sigs {
+		switch {
+		case d.Base == 0:
+			delta.New = append(delta.New, *d)
+		case d.Other == 0:
+			delta.Fixed = append(delta.Fixed, *d)
+		case d.Delta() != 0:
+			delta.Changed = append(delta.Changed, *d)
+		}
+	}
+	for _, ds := range [][]SignatureDelta{delta.New, delta.Fixed, delta.Changed} {
+		sort.SliceStable(ds, func(i, j int) bool { return abs(ds[i].Delta()) > abs(ds[j].Delta()) })
+	}
+	return delta
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// ParseJSON reads back a report rendered by goleaker.JSONFormatter.
+func ParseJSON(data []byte) (goleaker.LeakReport, error) {
+	var in struct {
+		Test     string                `json:"test"`
+		Cause    string                `json:"cause"`
+		Before   int                   `json:"before"`
+		After    int                   `json:"after"`
+		Peak     int                   `json:"peak"`
+		Timeline []goleaker.Checkpoint `json:"timeline"`
+		Leaks    []struct {
+			ID        uint64             `json:"id"`
+			Signature string             `json:"signature"`
+			Class     goleaker.LeakClass `json:"class"`
+			State     string             `json:"state"`
+			Top       string             `json:"top"`
+			Owner     string             `json:"owner"`
+			CreatedBy string             `json:"created_by"`
+			Stack     string             `json:"stack"`
+			Blame     *goleaker.Blame    `json:"blame"`
+		} `json:"leaks"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return goleaker.LeakReport{}, fmt.Errorf("goleaker: cannot decode report: %w", err)
+	}
+	r := goleaker.LeakReport{Test: in.Test, Cause: in.Cause, Before: in.Before, After: in.After, Peak: in.Peak, Timeline: in.Timeline}
+	for _, l := range in.Leaks {
+		g := &goleaker.Goroutine{ID: l.ID, State: l.State, CreatedBy: l.CreatedBy, Stack: l.Stack}
+		if gs, err := goleaker.ParseDump(l.Stack); err == nil && len(gs) == 1 {
+			g = &gs[0]
+		} else if l.Top != "" {
+			g.Frames = []goleaker.Frame{{Func: l.Top}}
+		}
+		r.Leaks = append(r.Leaks, goleaker.Leak{Goroutine: g, Signature: l.Signature, Class: l.Class, Owner: l.Owner, Blame: l.Blame})
+	}
+	return r, nil
+}
@@ -0,0 +1,142 @@
+// Package reportpb is the versioned schema of the leak reports of
+// goleaker, for dashboards, bots and other tools consuming them. The
+// schema is defined in report.proto; the types of this package mirror it
+// and read and write its proto3 JSON encoding, so goleaker needs no
+// protobuf runtime. Tools using protobuf can generate their own types
+// from report.proto and decode the same JSON.
+//
+// Reports are rendered with the Formatter of this package:
+//
+//	defer goleaker.Check(t, goleaker.WithFormatter(reportpb.Formatter))()
+package reportpb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// SchemaVersion is the version of report.proto this package writes. It is
+// only bumped by changes breaking consumers; fields are added without.
+const SchemaVersion = 1
+
+// Report is the Report message of report.proto.
+type Report struct {
+	SchemaVersion uint32       `json:"schemaVersion"`
+	Test          string       `json:"test,omitempty"`
+	Cause         string       `json:"cause,omitempty"`
+	Before        int32        `json:"before,omitempty"`
+	After         int32        `json:"after,omitempty"`
+	Peak          int32        `json:"peak,omitempty"`
+	Leaks         []Leak       `json:"leaks,omitempty"`
+	Timeline      []Checkpoint `json:"timeline,omitempty"`
+}
+
+// Leak is the Leak message of report.proto.
+type Leak struct {
+	GoroutineID uint64            `json:"goroutineId,omitempty,string"`
+	Signature   string            `json:"signature,omitempty"`
+	Class       string            `json:"class,omitempty"`
+	State       string            `json:"state,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	CreatedBy   string            `json:"createdBy,omitempty"`
+	Frames      []Frame           `json:"frames,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Stack       string            `json:"stack,omitempty"`
+	Blame       *Blame            `json:"blame,omitempty"`
+}
+
+// Blame is the Blame message of report.proto.
+type Blame struct {
+	Commit string    `json:"commit,omitempty"`
+	Author string    `json:"author,omitempty"`
+	Time   time.Time `json:"time,omitzero"`
+}
+
+// Frame is the Frame message of report.proto.
+type Frame struct {
+	Func string `json:"func,omitempty"`
+	File string `json:"file,omitempty"`
+	Line int32  `json:"line,omitempty"`
+}
+
+// Checkpoint is the Checkpoint message of report.proto.
+type Checkpoint struct {
+	Name       string    `json:"name,omitempty"`
+	Time       time.Time `json:"time"`
+	Goroutines int32     `json:"goroutines,omitempty"`
+}
+
+// Formatter renders reports as the proto3 JSON of a Report on one line.
+var Formatter goleaker.Formatter = goleaker.FormatterFunc(format)
+
+func format(r goleaker.LeakReport) string {
+	b, err := Marshal(FromLeakReport(r))
+	if err != nil {
+		return "leaktest: " + err.Error()
+	}
+	return string(b)
+}
+
+// FromLeakReport converts the report of a check.
+func FromLeakReport(r goleaker.LeakReport) *Report {
+	out := &Report{SchemaVersion: SchemaVersion, Test: r.Test, Cause: r.Cause,
+		Before: int32(r.Before), After: int32(r.After), Peak: int32(r.Peak)}
+	for _, l := range r.Leaks {
+		g := l.Goroutine
+		pl := Leak{GoroutineID: g.ID, Signature: l.Signature, Class: string(l.Class), State: g.State, Owner: l.Owner,
+			CreatedBy: g.CreatedBy, Labels: g.Labels, Stack: g.Stack}
+		for _, f := range g.Frames {
+			pl.Frames = append(pl.Frames, Frame{Func: f.Func, File: f.File, Line: int32(f.Line)})
+		}
+		if b := l.Blame; b != nil {
+			pl.Blame = &Blame{Commit: b.Commit, Author: b.Author, Time: b.Time}
+		}
+		out.Leaks = append(out.Leaks, pl)
+	}
+	for _, c := range r.Timeline {
+		out.Timeline = append(out.Timeline, Checkpoint{Name: c.Name, Time: c.Time, Goroutines: int32(c.Goroutines)})
+	}
+	return out
+}
+
+// LeakReport converts r back, e.g. to compare it with report.Diff.
+func (r *Report) LeakReport() goleaker.LeakReport {
+	out := goleaker.LeakReport{Test: r.Test, Cause: r.Cause, Before: int(r.Before), After: int(r.After), Peak: int(r.Peak)}
+	for _, l := range r.Leaks {
+		g := &goleaker.Goroutine{ID: l.GoroutineID, State: l.State, CreatedBy: l.CreatedBy, Labels: l.Labels, Stack: l.Stack}
+		for _, f := range l.Frames {
+			g.Frames = append(g.Frames, goleaker.Frame{Func: f.Func, File: f.File, Line: int(f.Line)})
+		}
+		leak := goleaker.Leak{Goroutine: g, Signature: l.Signature, Class: goleaker.LeakClass(l.Class), Owner: l.Owner}
+		if b := l.Blame; b != nil {
+			leak.Blame = &goleaker.Blame{Commit: b.Commit, Author: b.Author, Time: b.Time}
+		}
+		out.Leaks = append(out.Leaks, leak)
+	}
+	for _, c := range r.Timeline {
+		out.Timeline = append(out.Timeline, goleaker.Checkpoint{Name: c.Name, Time: c.Time, Goroutines: int(c.Goroutines)})
+	}
+	return out
+}
+
+// Marshal encodes r as proto3 JSON.
+func Marshal(r *Report) ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// Unmarshal decodes the proto3 JSON of a Report. Unknown fields, added by
+// later minor versions of the schema, are ignored; reports of a later
+// SchemaVersion are rejected.
+func Unmarshal(data []byte) (*Report, error) {
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("goleaker: cannot decode report: %w", err)
+	}
+	if r.SchemaVersion == 0 || r.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("goleaker: unsupported report schema version %d, this version supports up to %d", r.SchemaVersion, SchemaVersion)
+	}
+	return &r, nil
+}
@@ -0,0 +1,205 @@
+// Package resource tracks resources goleaker cannot see, such as mmap
+// regions, GPU handles or C allocations, so tests can assert that every
+// one acquired was released, with the stack that acquired the others:
+//
+//	addr := mmap(size)
+//	resource.Acquire("mmap", addr, "")
+//	...
+//	munmap(addr)
+//	resource.Release("mmap", addr)
+//
+// and in tests:
+//
+//	defer resource.Check(t, nil)()
+package resource
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// Grace is how long checks wait for resources to be released, e.g. by
+// finalizers or background closers.
+var Grace time.Duration
+
+type key struct {
+	kind string
+	id   interface{}
+}
+
+type acquisition struct {
+	seq   uint64
+	stack string
+}
+
+// Tracker records the resources acquired and not yet released. The zero
+// value is ready to use.
+type Tracker struct {
+	mu   sync.Mutex
+	seq  uint64
+	live map[key]acquisition
+}
+
+// Default is the Tracker of the package level functions.
+var Default = &Tracker{}
+
+// Acquire records that the resource id of kind was acquired. id must be
+// comparable, e.g. an address or a handle. stack is the stack to report
+// if it is never released; when empty, the stack of the caller is taken.
+// Acquiring a resource again replaces its stack.
+func (tr *Tracker) Acquire(kind string, id interface{}, stack string) {
+	if stack == "" {
+		stack = callers(3)
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.live == nil {
+		tr.live = map[key]acquisition{}
+	}
+	tr.seq++
+	tr.live[key{kind, id}] = acquisition{seq: tr.seq, stack: stack}
+}
+
+// Release records that the resource id of kind was released. Releasing a
+// resource that was not acquired does nothing.
+func (tr *Tracker) Release(kind string, id interface{}) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	delete(tr.live, key{kind, id})
+}
+
+// Check returns a function to be run at the end of tests which reports
+// the resources of the given kinds, or of every kind if nil, acquired
+// since and not released after Grace. The leaks are reported as
+// goleaker.ReportFinding does with opts, so goleaker.WithDryRun and
+// goleaker.WithFormatter apply.
+func (tr *Tracker) Check(t goleaker.ErrorReporter, kinds []string, opts ...goleaker.Option) func() {
+	tr.mu.Lock()
+	since := tr.seq
+	tr.mu.Unlock()
+	return func() {
+		tr.verify(t, since, kinds, opts)
+	}
+}
+
+// VerifyReleased reports the resources of the given kinds, or of every
+// kind if nil, not released after Grace.
+func (tr *Tracker) VerifyReleased(t goleaker.ErrorReporter, kinds []string, opts ...goleaker.Option) {
+	tr.verify(t, 0, kinds, opts)
+}
+
+// Acquire records an acquisition with the Default tracker.
+func Acquire(kind string, id interface{}, stack string) {
+	if stack == "" {
+		stack = callers(3)
+	}
+	Default.Acquire(kind, id, stack)
+}
+
+// Release records a release with the Default tracker.
+func Release(kind string, id interface{}) {
+	Default.Release(kind, id)
+}
+
+// Check is Default.Check.
+func Check(t goleaker.ErrorReporter, kinds []string, opts ...goleaker.Option) func() {
+	return Default.Check(t, kinds, opts...)
+}
+
+// VerifyReleased is Default.VerifyReleased.
+func VerifyReleased(t goleaker.ErrorReporter, kinds []string, opts ...goleaker.Option) {
+	Default.VerifyReleased(t, kinds, opts...)
+}
+
+// leak is a group of resources of a kind acquired at the same stack.
+type leak struct {
+	kind, stack string
+	ids         []string
+}
+
+func (tr *Tracker) verify(t goleaker.ErrorReporter, since uint64, kinds []string, opts []goleaker.Option) {
+	deadline := time.Now().Add(Grace)
+	for {
+		leaks := tr.leaks(since, kinds)
+		if len(leaks) == 0 {
+			return
+		}
+		if time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		for _, l := range leaks {
+			ids := l.ids
+			if len(ids) > 5 {
+				ids = append(ids[:5:5], "...")
+			}
+			goleaker.ReportFinding(t, goleaker.Finding{
+				Kind:    l.kind,
+				Message: fmt.Sprintf("%d %s resource(s) not released (%s)", len(l.ids), l.kind, strings.Join(ids, ", ")),
+				Stack:   l.stack,
+			}, opts...)
+		}
+		return
+	}
+}
+
+// leaks groups the live resources acquired after since by kind and stack,
+// largest group first.
+func (tr *Tracker) leaks(since uint64, kinds []string) []*leak {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	type live struct {
+		key
+		acquisition
+	}
+	var ls []live
+	for k, a := range tr.live {
+		if a.seq > since && (len(kinds) == 0 || contains(kinds, k.kind)) {
+			ls = append(ls, live{k, a})
+		}
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].seq < ls[j].seq })
+	var leaks []*leak
+	byStack := map[[2]string]*leak{}
+	for _, l := range ls {
+		g := byStack[[2]string{l.kind, l.stack}]
+		if g == nil {
+			g = &leak{kind: l.kind, stack: l.stack}
+			byStack[[2]string{l.kind, l.stack}] = g
+			leaks = append(leaks, g)
+		}
+		g.ids = append(g.ids, fmt.Sprint(l.id))
+	}
+	sort.SliceStable(leaks, func(i, j int) bool { return len(leaks[i].ids) > len(leaks[j].ids) })
+	return leaks
+}
+
+func contains(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// callers formats the stack of the calling goroutine, leaving out skip
+// frames as runtime.Callers does.
+func callers(skip int) string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(skip, pcs)])
+	var b strings.Builder
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s()\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			return strings.TrimSuffix(b.String(), "\n")
+		}
+	}
+}
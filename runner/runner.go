@@ -0,0 +1,92 @@
+// Package runner wraps test binaries with goleaker.VerifyTestMain,
+// configured from the environment instead of code, for the test launchers
+// of hermetic build systems such as Bazel and Please. A rule generating
+// the main of a go_test adds the TestMain below to packages without one,
+// and every test binary it builds checks for leaks:
+//
+//	func TestMain(m *testing.M) {
+//		runner.Main(m)
+//	}
+//
+// The config is read from goleaker.ConfigEnv and the variables below.
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// The variables configuring Main.
+const (
+	// DisableEnv turns the check off when set to a true value, e.g. for
+	// targets known to leak.
+	DisableEnv = "GOLEAKER_DISABLE"
+	// TimeoutEnv is how long to wait for goroutines to exit once all tests
+	// ran, as a duration such as "5s".
+	TimeoutEnv = "GOLEAKER_TIMEOUT"
+	// IgnorePackagesEnv is a comma separated list of package patterns, as
+	// for goleaker.IgnorePackages.
+	IgnorePackagesEnv = "GOLEAKER_IGNORE_PACKAGES"
+	// StrictEnv enables goleaker.Strict when set to a true value.
+	StrictEnv = "GOLEAKER_STRICT"
+	// ArtifactDirEnv is the directory of goleaker.WithFailureArtifact. It
+	// defaults to TEST_UNDECLARED_OUTPUTS_DIR, under which Bazel keeps the
+	// artifacts of failed tests.
+	ArtifactDirEnv = "GOLEAKER_ARTIFACT_DIR"
+)
+
+// Main runs the tests of m, checks for leaks as configured by the
+// environment and exits.
+func Main(m interface{ Run() int }) {
+	if off, _ := strconv.ParseBool(os.Getenv(DisableEnv)); off {
+		os.Exit(m.Run())
+	}
+	opts, err := Options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goleaker: %s\n", err)
+		os.Exit(2)
+	}
+	if s := os.Getenv(TimeoutEnv); s != "" {
+		// Options already checked it parses
+		goleaker.TestMainGracePeriod, _ = time.ParseDuration(s)
+	}
+	goleaker.VerifyTestMain(m, opts...)
+}
+
+// Options returns the options set by the environment, for launchers
+// running the checks some other way.
+func Options() ([]goleaker.Option, error) {
+	var opts []goleaker.Option
+	if s := os.Getenv(TimeoutEnv); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", TimeoutEnv, err)
+		}
+		opts = append(opts, goleaker.WithTimeout(d))
+	}
+	if s := os.Getenv(IgnorePackagesEnv); s != "" {
+		opts = append(opts, goleaker.IgnorePackages(strings.Split(s, ",")...))
+	}
+	if s := os.Getenv(StrictEnv); s != "" {
+		strict, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", StrictEnv, err)
+		}
+		if strict {
+			opts = append(opts, goleaker.Strict())
+		}
+	}
+	dir := os.Getenv(ArtifactDirEnv)
+	if dir == "" {
+		dir = os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	}
+	if dir != "" {
+		opts = append(opts, goleaker.WithFailureArtifact(dir))
+	}
+	return opts, nil
+}
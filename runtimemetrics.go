@@ -0,0 +1,122 @@
+package goleaker
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+// RuntimeMetrics are the runtime/metrics a Monitor samples along with the
+// goroutines, to tell growth under load from a leak. Metrics the runtime
+// does not support are left zero.
+type RuntimeMetrics struct {
+	// Goroutines is the number of live goroutines and Created the number
+	// created since the previous report.
+	Goroutines int64  `json:"goroutines"`
+	Created    uint64 `json:"created,omitempty"`
+	Threads    int64  `json:"threads,omitempty"`
+	GOMAXPROCS int64  `json:"gomaxprocs"`
+	// CgoCalls is the number of calls into C since the previous report.
+	CgoCalls uint64 `json:"cgo_calls"`
+	// SchedLatencyP50 and SchedLatencyP99 are percentiles of how long
+	// goroutines waited to run since the previous report.
+	SchedLatencyP50 time.Duration `json:"sched_latency_p50_ns"`
+	SchedLatencyP99 time.Duration `json:"sched_latency_p99_ns"`
+}
+
+func (m RuntimeMetrics) String() string {
+	s := fmt.Sprintf("%s goroutines", formatCount(int(m.Goroutines)))
+	if m.Created > 0 {
+		s += fmt.Sprintf(" (%s created)", formatCount(int(m.Created)))
+	}
+	if m.Threads > 0 {
+		s += fmt.Sprintf(", %d threads", m.Threads)
+	}
+	return s + fmt.Sprintf(", GOMAXPROCS %d, %s cgo calls, sched latency p50 %v p99 %v",
+		m.GOMAXPROCS, formatCount(int(m.CgoCalls)), m.SchedLatencyP50, m.SchedLatencyP99)
+}
+
+const (
+	metricGoroutines = "/sched/goroutines:goroutines"
+	metricCreated    = "/sched/goroutines-created:goroutines"
+	metricThreads    = "/sched/threads/total:threads"
+	metricGOMAXPROCS = "/sched/gomaxprocs:threads"
+	metricCgoCalls   = "/cgo/go-to-c-calls:calls"
+	metricLatencies  = "/sched/latencies:seconds"
+)
+
+// metricsSampler samples RuntimeMetrics, turning the cumulative metrics
+// into the change since its previous sample.
+type metricsSampler struct {
+	samples   []metrics.Sample
+	created   uint64
+	cgoCalls  uint64
+	latencies []uint64
+}
+
+func (s *metricsSampler) sample() RuntimeMetrics {
+	if s.samples == nil {
+		for _, name := range []string{metricGoroutines, metricCreated, metricThreads, metricGOMAXPROCS, metricCgoCalls, metricLatencies} {
+			s.samples = append(s.samples, metrics.Sample{Name: name})
+		}
+	}
+	metrics.Read(s.samples)
+	var m RuntimeMetrics
+	for _, sample := range s.samples {
+		v := sample.Value
+		switch {
+		case v.Kind() == metrics.KindUint64:
+			n := v.Uint64()
+			switch sample.Name {
+			case metricGoroutines:
+				m.Goroutines = int64(n)
+			case metricCreated:
+				m.Created, s.created = n-s.created, n
+			case metricThreads:
+				m.Threads = int64(n)
+			case metricGOMAXPROCS:
+				m.GOMAXPROCS = int64(n)
+			case metricCgoCalls:
+				m.CgoCalls, s.cgoCalls = n-s.cgoCalls, n
+			}
+		case v.Kind() == metrics.KindFloat64Histogram && sample.Name == metricLatencies:
+			h := v.Float64Histogram()
+			delta := make([]uint64, len(h.Counts))
+			for i, c := range h.Counts {
+				delta[i] = c
+				if i < len(s.latencies) {
+					delta[i] -= s.latencies[i]
+				}
+			}
+			s.latencies = append(s.latencies[:0], h.Counts...)
+			m.SchedLatencyP50 = percentile(h.Buckets, delta, 0.50)
+			m.SchedLatencyP99 = percentile(h.Buckets, delta, 0.99)
+		}
+	}
+	return m
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// fraction of the counts of a runtime/metrics histogram, in seconds.
+func percentile(buckets []float64, counts []uint64, p float64) time.Duration {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p * float64(total)))
+	var seen uint64
+	for i, c := range counts {
+		if seen += c; seen >= rank {
+			upper := buckets[i+1]
+			if math.IsInf(upper, 1) {
+				upper = buckets[i]
+			}
+			return time.Duration(upper * float64(time.Second))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package goleaker
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// WithSampling makes a check poll with the goroutine profile, which only
+// yields counts per stack, instead of a full dump of every goroutine. The
+// baseline, the final failure report and the poll that passes still use
+// full dumps, so a check that passes pays for two. Matchers only see the
+// frames of sampled goroutines, without their creator, so when the full
+// dump finds leaks a sample missed, e.g. with IgnorePackages or
+// RequireCreatedInTest, the check polls with full dumps from then on. It
+// has no effect with WithSource.
+func WithSampling() Option {
+	return func(o *options) {
+		o.sampling = true
+	}
+}
+
+// samplingLive reports whether the check polls with samples.
+func (o *options) samplingLive() bool {
+	_, ok := o.source.(runtimeSource)
+	return o.sampling && ok && FullStacks
+}
+
+// sampleCounts maps signatures of interesting goroutines to their number.
+type sampleCounts map[string]int
+
+// sample counts the interesting goroutines per signature from the
+// goroutine profile and returns the counts along with the number of
+// goroutines sampled.
+func (o *options) sample() (sampleCounts, int) {
+	var records []runtime.StackRecord
+	n := runtime.NumGoroutine()
+	for {
+		records = make([]runtime.StackRecord, n+n/4+8)
+		var ok bool
+		if n, ok = runtime.GoroutineProfile(records); ok {
+			records = records[:n]
+			break
+		}
+	}
+	stacks := map[[32]uintptr]int{}
+	for _, r := range records {
+		stacks[r.Stack0]++
+	}
+	counts := sampleCounts{}
+	for stack0, n := range stacks {
+		if g, ok := sampledGoroutine(stack0); ok && o.interesting(&g) {
+			counts[signature(g.Stack)] += n
+		}
+	}
+	return counts, len(records)
+}
+
+// sampledGoroutine renders a profile stack as a traceback and parses it.
+func sampledGoroutine(stack0 [32]uintptr) (Goroutine, bool) {
+	r := runtime.StackRecord{Stack0: stack0}
+	var b strings.Builder
+	b.WriteString("goroutine 0 [sampled]:\n")
+	frames := runtime.CallersFrames(r.Stack())
+	for {
+		f, more := frames.Next()
+		// tracebacks leave out the frame every goroutine returns to
+		if f.Function != "" && f.Function != "runtime.goexit" {
+			fmt.Fprintf(&b, "%s(...)\n\t%s:%d\n", f.Function, f.File, f.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	g, err := parseGoroutine(strings.TrimSuffix(b.String(), "\n"))
+	return g, err == nil
+}
+
+// within reports whether no signature has more goroutines than in base.
+func (s sampleCounts) within(base sampleCounts) bool {
+	for sig, n := range s {
+		if n > base[sig] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package goleaker
+
+import "strings"
+
+// VerifyFilters runs the filters and options against the goroutine dump at
+// dumpPath and checks how each goroutine is classified. Every entry of
+// wantIgnored and wantReported is a substring of the goroutine stacks it
+// refers to: goroutines matching wantIgnored must be ignored, goroutines
+// matching wantReported must be reported, and each entry must match at
+// least one goroutine. It lets suppression configs be validated against
+// recorded dumps before they are rolled out.
+func VerifyFilters(t ErrorReporter, dumpPath string, wantIgnored, wantReported []string, opts ...Option) {
+	o := newOptions(opts)
+	if o.configErr != nil {
+		t.Errorf("leaktest: %s", o.configErr)
+	}
+	if o.requireCreatedInTest {
+		o.testFunc = currentTestFunc()
+	}
+	gs, err := FileSource(dumpPath).Capture()
+	if err != nil {
+		t.Errorf("leaktest: %s", err)
+	}
+	check := func(want []string, reported bool) {
+		for _, sub := range want {
+			matched := false
+			for i := range gs {
+				g := &gs[i]
+				if !strings.Contains(g.Stack, sub) {
+					continue
+				}
+				matched = true
+				if o.interesting(g) != reported {
+					if reported {
+						t.Errorf("leaktest: %q: goroutine %d is ignored, want reported:\n%s", sub, g.ID, g.Stack)
+					} else {
+						t.Errorf("leaktest: %q: goroutine %d is reported, want ignored:\n%s", sub, g.ID, g.Stack)
+					}
+				}
+			}
+			if !matched {
+				t.Errorf("leaktest: %q matches no goroutine in %s", sub, dumpPath)
+			}
+		}
+	}
+	check(wantIgnored, false)
+	check(wantReported, true)
+}
@@ -0,0 +1,51 @@
+package goleaker
+
+// sleepLoops follows the goroutines sleeping in time.Sleep across the
+// polls of a check. A goroutine found sleeping under the same caller in
+// two consecutive polls is taken for a polling loop, the usual shape of a
+// loop that never checks its context.
+type sleepLoops struct {
+	prev  map[uint64]string
+	loops map[uint64]bool
+}
+
+// observe records the sleeping goroutines of one poll.
+func (s *sleepLoops) observe(gs []*Goroutine) {
+	cur := make(map[uint64]string, len(s.prev))
+	for _, g := range gs {
+		caller := sleepCaller(g)
+		if caller == "" {
+			continue
+		}
+		if s.prev[g.ID] == caller {
+			if s.loops == nil {
+				s.loops = map[uint64]bool{}
+			}
+			s.loops[g.ID] = true
+		}
+		cur[g.ID] = caller
+	}
+	s.prev = cur
+}
+
+// loop reports whether g was seen sleeping in a polling loop.
+func (s *sleepLoops) loop(g *Goroutine) bool {
+	return s.loops[g.ID] && sleepCaller(g) != ""
+}
+
+// sleepCaller returns the function calling time.Sleep on top of the stack
+// of g, or "".
+func sleepCaller(g *Goroutine) string {
+	if g.State != "sleep" {
+		return ""
+	}
+	for i, f := range g.Frames {
+		if f.Func == "time.Sleep" {
+			if i+1 < len(g.Frames) {
+				return g.Frames[i+1].Func
+			}
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,251 @@
+package goleaker
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"time"
+)
+
+// SoakInterval is how often Soak samples the goroutine, file descriptor
+// and heap counts.
+var SoakInterval = 100 * time.Millisecond
+
+// SoakLimits bounds the growth Soak tolerates, as the slope of the linear
+// trend per iteration. A limit of zero disables its check.
+type SoakLimits struct {
+	Goroutines float64
+	FDs        float64
+	// HeapBytes is the growth of the live heap in bytes.
+	HeapBytes float64
+}
+
+// DefaultSoakLimits tolerates one leaked goroutine or file descriptor
+// every hundred iterations and 1KiB of heap per iteration.
+var DefaultSoakLimits = SoakLimits{Goroutines: 0.01, FDs: 0.01, HeapBytes: 1024}
+
+// WithSoakLimits sets the growth Soak tolerates.
+func WithSoakLimits(l SoakLimits) Option {
+	return func(o *options) {
+		o.soakLimits = &l
+	}
+}
+
+// WithCacheSize makes Soak sample the size of a cache or pool with size
+// along with the other resources, and include its trend in the
+// *SoakError, to tell goroutine leaks from unbounded cache growth when
+// memory climbs. Caches do not fail a soak on their own.
+func WithCacheSize(name string, size func() int) Option {
+	return func(o *options) {
+		o.caches = append(o.caches, observedCache{name: name, size: size})
+	}
+}
+
+type observedCache struct {
+	name string
+	size func() int
+}
+
+// Trend is the linear trend of one resource over a soak.
+type Trend struct {
+	Resource string
+	// Slope is the growth per iteration and Limit the tolerated slope.
+	Slope, Limit float64
+	// First and Last are the first and last sampled values.
+	First, Last float64
+}
+
+func (tr Trend) String() string {
+	if tr.Limit == 0 {
+		return fmt.Sprintf("%s grew by %.4g per iteration, from %.0f to %.0f", tr.Resource, tr.Slope, tr.First, tr.Last)
+	}
+	return fmt.Sprintf("%s grew by %.4g per iteration (limit %.4g), from %.0f to %.0f",
+		tr.Resource, tr.Slope, tr.Limit, tr.First, tr.Last)
+}
+
+// SoakError is returned by Soak when a resource grew faster than its
+// limit.
+type SoakError struct {
+	Iterations int
+	Trends     []Trend
+	// Caches are the trends of the caches of WithCacheSize.
+	Caches []Trend
+}
+
+func (e *SoakError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "goleaker: soak of %d iterations leaked:", e.Iterations)
+	for _, tr := range e.Trends {
+		b.WriteString("\n\t" + tr.String())
+	}
+	for _, tr := range e.Caches {
+		b.WriteString("\n\tcache " + tr.String())
+	}
+	return b.String()
+}
+
+// findings are the trends of e, one finding each.
+func (e *SoakError) findings() []Finding {
+	var fs []Finding
+	for _, tr := range e.Trends {
+		fs = append(fs, Finding{Kind: "soak", Message: fmt.Sprintf("soak of %d iterations: %s", e.Iterations, tr)})
+	}
+	for _, tr := range e.Caches {
+		fs = append(fs, Finding{Kind: "soak", Message: fmt.Sprintf("soak of %d iterations: cache %s", e.Iterations, tr)})
+	}
+	return fs
+}
+
+// Soak runs iteration over and over for d or until ctx is done, samples
+// the number of goroutines, open file descriptors and the live heap every
+// SoakInterval, and fits a linear trend to each over the iterations run.
+// It returns a *SoakError if any of them grew faster than the limits set
+// with WithSoakLimits, DefaultSoakLimits by default. Samples taken during
+// the WithWarmup period are left out. File descriptors, handles on
+// Windows, are counted on Linux, macOS and Windows.
+func Soak(ctx context.Context, d time.Duration, iteration func(), opts ...Option) error {
+	o := newOptions(opts)
+	if o.configErr != nil {
+		return o.configErr
+	}
+	limits := DefaultSoakLimits
+	if o.soakLimits != nil {
+		limits = *o.soakLimits
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	var (
+		samples []soakSample
+		n       int
+		next    = time.Now().Add(o.warmup)
+	)
+	for ctx.Err() == nil {
+		iteration()
+		n++
+		if now := time.Now(); !now.Before(next) {
+			samples = append(samples, takeSoakSample(o, n))
+			next = now.Add(SoakInterval)
+		}
+	}
+	if !time.Now().Before(next) {
+		samples = append(samples, takeSoakSample(o, n))
+	}
+
+	var leaks []Trend
+	for _, r := range []struct {
+		name  string
+		limit float64
+		value func(s soakSample) (float64, bool)
+	}{
+		{"goroutines", limits.Goroutines, func(s soakSample) (float64, bool) { return s.goroutines, true }},
+		{"file descriptors", limits.FDs, func(s soakSample) (float64, bool) { return s.fds, s.hasFDs }},
+		{"live heap bytes", limits.HeapBytes, func(s soakSample) (float64, bool) { return s.heap, s.heap > 0 }},
+	} {
+		if r.limit <= 0 {
+			continue
+		}
+		var xs, ys []float64
+		for _, s := range samples {
+			if v, ok := r.value(s); ok {
+				xs = append(xs, float64(s.iteration))
+				ys = append(ys, v)
+			}
+		}
+		slope, ok := linearSlope(xs, ys)
+		if ok && slope > r.limit {
+			leaks = append(leaks, Trend{Resource: r.name, Slope: slope, Limit: r.limit, First: ys[0], Last: ys[len(ys)-1]})
+		}
+	}
+	if len(leaks) > 0 {
+		err := &SoakError{Iterations: n, Trends: leaks, Caches: cacheTrends(o, samples)}
+		if o.dryRun {
+			o.sink(MonitorReport{Findings: err.findings()})
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+type soakSample struct {
+	iteration  int
+	goroutines float64
+	fds        float64
+	hasFDs     bool
+	heap       float64
+	// caches are the sizes of the caches of the options, in order.
+	caches []float64
+}
+
+// heapMetric is the live heap as of the last garbage collection, which
+// is cheaper to read than runtime.MemStats and not skewed by garbage.
+const heapMetric = "/gc/heap/live:bytes"
+
+func takeSoakSample(o *options, iteration int) soakSample {
+	s := soakSample{iteration: iteration, goroutines: float64(runtime.NumGoroutine())}
+	for _, c := range o.caches {
+		s.caches = append(s.caches, float64(c.size()))
+	}
+	if n, ok := openFDs(); ok {
+		s.fds, s.hasFDs = float64(n), true
+	}
+	m := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(m)
+	if m[0].Value.Kind() == metrics.KindUint64 {
+		s.heap = float64(m[0].Value.Uint64())
+	}
+	return s
+}
+
+// cacheTrends fits a linear trend to the size of every cache of o.
+func cacheTrends(o *options, samples []soakSample) []Trend {
+	var trends []Trend
+	for i, c := range o.caches {
+		var xs, ys []float64
+		for _, s := range samples {
+			xs = append(xs, float64(s.iteration))
+			ys = append(ys, s.caches[i])
+		}
+		if slope, ok := linearSlope(xs, ys); ok {
+			trends = append(trends, Trend{Resource: c.name, Slope: slope, First: ys[0], Last: ys[len(ys)-1]})
+		}
+	}
+	return trends
+}
+
+// linearSlope returns the slope of the least squares fit of ys over xs,
+// and false when there is no spread in xs to fit over.
+func linearSlope(xs, ys []float64) (float64, bool) {
+	n := float64(len(xs))
+	if n < 2 {
+		return 0, false
+	}
+	var sx, sy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+	}
+	mx, my := sx/n, sy/n
+	var sxy, sxx float64
+	for i := range xs {
+		dx := xs[i] - mx
+		sxy += dx * (ys[i] - my)
+		sxx += dx * dx
+	}
+	if sxx == 0 {
+		return 0, false
+	}
+	return sxy / sxx, true
+}
+
+// WithWarmup excludes the first d of a Soak or Monitor from the analysis,
+// so caches filling up and pools ramping up do not count as growth. A
+// Monitor takes its baseline once the warm-up is over.
+func WithWarmup(d time.Duration) Option {
+	return func(o *options) {
+		o.warmup = d
+	}
+}
@@ -0,0 +1,91 @@
+package goleaker
+
+import "strings"
+
+// socket is an open socket of the process.
+type socket struct {
+	inode uint64
+	// proto is "tcp", "tcp6", "udp" or "udp6".
+	proto         string
+	local, remote string
+	// listening is set for listeners and unconnected UDP sockets.
+	listening bool
+}
+
+func (s socket) String() string {
+	switch {
+	case s.listening && strings.HasPrefix(s.proto, "udp"):
+		return s.proto + " on " + s.local
+	case s.listening:
+		return s.proto + " listening on " + s.local
+	}
+	return s.proto + " " + s.local + "->" + s.remote
+}
+
+// newSockets returns the sockets open now which were not when the inodes
+// of before were listed.
+func newSockets(before map[uint64]bool) []socket {
+	if before == nil {
+		return nil
+	}
+	all, ok := openSockets()
+	if !ok {
+		return nil
+	}
+	var socks []socket
+	for _, s := range all {
+		if !before[s.inode] {
+			socks = append(socks, s)
+		}
+	}
+	return socks
+}
+
+// netFDOp returns the method of net.(*netFD) g is blocked in, e.g. "Read"
+// or "accept", and false when it is not blocked on a socket.
+func netFDOp(g *Goroutine) (string, bool) {
+	if g.State != "IO wait" {
+		return "", false
+	}
+	for _, f := range g.Frames {
+		if op, ok := strings.CutPrefix(f.Func, "net.(*netFD)."); ok {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// blockedSocket describes the sockets opened during the check g may be
+// blocked on: the remote address of a connection, the address of a
+// listener for goroutines accepting, or of a UDP socket for those reading
+// packets. It returns "" when g is not blocked
+// on a socket or no candidate is left open.
+func (o *options) blockedSocket(g *Goroutine) string {
+	op, ok := netFDOp(g)
+	if !ok || len(o.sockets) == 0 {
+		return ""
+	}
+	packets := strings.HasPrefix(op, "readFrom") || strings.HasPrefix(op, "readMsg") ||
+		strings.HasPrefix(op, "writeTo") || strings.HasPrefix(op, "writeMsg")
+	var candidates []string
+	for _, s := range o.sockets {
+		udp := strings.HasPrefix(s.proto, "udp")
+		switch {
+		case op == "accept" && !udp && s.listening,
+			packets && udp,
+			op != "accept" && !s.listening:
+			candidates = append(candidates, s.String())
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return ""
+	case 1:
+		return "blocked on socket " + candidates[0]
+	}
+	if len(candidates) > 3 {
+		candidates = append(candidates[:3], "...")
+	}
+	return "blocked on one of the sockets " + strings.Join(candidates, ", ")
+}
@@ -0,0 +1,96 @@
+package goleaker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// openSocketInodes lists the socket inodes among the file descriptors of
+// the process, which link to "socket:[inode]".
+func openSocketInodes() (map[uint64]bool, bool) {
+	f, err := os.Open(fdDir)
+	if err != nil {
+		return nil, false
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, false
+	}
+	inodes := map[uint64]bool{}
+	for _, name := range names {
+		link, err := os.Readlink(fdDir + "/" + name)
+		if err != nil {
+			continue
+		}
+		if s, ok := strings.CutPrefix(link, "socket:["); ok {
+			if inode, err := strconv.ParseUint(strings.TrimSuffix(s, "]"), 10, 64); err == nil {
+				inodes[inode] = true
+			}
+		}
+	}
+	return inodes, true
+}
+
+// openSockets returns the TCP and UDP sockets of the process, from the
+// socket tables of /proc/self/net.
+func openSockets() ([]socket, bool) {
+	inodes, ok := openSocketInodes()
+	if !ok {
+		return nil, false
+	}
+	var socks []socket
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open("/proc/self/net/" + proto)
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(f)
+		// the header line
+		sc.Scan()
+		for sc.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			fields := strings.Fields(sc.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			inode, err := strconv.ParseUint(fields[9], 10, 64)
+			if err != nil || !inodes[inode] {
+				continue
+			}
+			s := socket{inode: inode, proto: proto, local: procAddr(fields[1]), remote: procAddr(fields[2])}
+			// 0A is TCP_LISTEN; unconnected UDP sockets have no remote
+			s.listening = fields[3] == "0A" || strings.HasPrefix(proto, "udp") && strings.HasSuffix(fields[2], ":0000")
+			socks = append(socks, s)
+		}
+		f.Close()
+	}
+	return socks, true
+}
+
+// procAddr decodes an address of /proc/net/tcp, "0100007F:1F90", into
+// "127.0.0.1:8080". The address is made of 32 bit words in host order.
+func procAddr(s string) string {
+	host, port, ok := strings.Cut(s, ":")
+	b, err := hex.DecodeString(host)
+	if !ok || err != nil || len(b)%4 != 0 {
+		return s
+	}
+	for i := 0; i < len(b); i += 4 {
+		binary.BigEndian.PutUint32(b[i:], binary.NativeEndian.Uint32(b[i:]))
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return s
+	}
+	ip := net.IP(b)
+	if v4 := ip.To4(); v4 != nil && len(b) == 16 {
+		ip = v4
+	}
+	return net.JoinHostPort(ip.String(), strconv.FormatUint(p, 10))
+}
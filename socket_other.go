@@ -0,0 +1,11 @@
+//go:build !linux
+
+package goleaker
+
+func openSocketInodes() (map[uint64]bool, bool) {
+	return nil, false
+}
+
+func openSockets() ([]socket, bool) {
+	return nil, false
+}
@@ -0,0 +1,307 @@
+package goleaker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Goroutine is a single goroutine parsed from a stack dump.
+type Goroutine struct {
+	// ID is the goroutine id from the header line.
+	ID uint64
+	// State is the wait reason from the header line, e.g. "chan receive".
+	State string
+	// Wait is how long the goroutine has been blocked, which the runtime
+	// only reports in whole minutes.
+	Wait time.Duration
+	// Frames are the goroutine's stack frames, innermost first.
+	Frames []Frame
+	// Labels are the pprof labels of the goroutine. The runtime only
+	// prints them with GODEBUG=tracebacklabels=1, the default for main
+	// modules declaring go 1.27 or later.
+	Labels map[string]string
+	// CreatedBy is the function in the "created by" line, if any.
+	CreatedBy string
+	// Stack is the goroutine's full traceback, header line included.
+	Stack string
+}
+
+// Frame is a single frame of a goroutine's stack.
+type Frame struct {
+	Func string
+	File string
+	Line int
+}
+
+type goroutines []*Goroutine
+
+func (g goroutines) Len() int           { return len(g) }
+func (g goroutines) Less(i, j int) bool { return g[i].ID < g[j].ID }
+func (g goroutines) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
+
+// Source captures the goroutines a check compares. Capture may return the
+// goroutines it could parse together with an error for the rest.
+type Source interface {
+	Capture() ([]Goroutine, error)
+}
+
+// WithSource makes a check capture goroutines from s instead of the
+// running process.
+func WithSource(s Source) Option {
+	return func(o *options) {
+		o.source = s
+	}
+}
+
+// RuntimeSource returns the default Source, which captures every goroutine
+// of the current process with runtime.Stack. Where the runtime cannot dump
+// every goroutine, see FullStacks, it only captures their number. It only
+// parses the goroutines which changed since its previous capture, so the
+// goroutines it returns share their Frames and Labels with earlier ones.
+func RuntimeSource() Source {
+	return runtimeSource{cache: &parseCache{}}
+}
+
+type runtimeSource struct {
+	cache *parseCache
+}
+
+func (s runtimeSource) Capture() ([]Goroutine, error) {
+	return captureStacks(s.cache)
+}
+
+// FileSource returns a Source reading canned goroutine dumps from files,
+// as printed by runtime.Stack, an unrecovered panic, SIGQUIT or
+// /debug/pprof/goroutine?debug=2. Each Capture reads the next file and the
+// last one is repeated, so FileSource("before.txt", "after.txt") replays a
+// baseline and a final state deterministically.
+func FileSource(paths ...string) Source {
+	return &fileSource{paths: paths}
+}
+
+type fileSource struct {
+	paths []string
+	next  int
+}
+
+func (s *fileSource) Capture() ([]Goroutine, error) {
+	if len(s.paths) == 0 {
+		return nil, errors.New("no dump files")
+	}
+	path := s.paths[s.next]
+	if s.next < len(s.paths)-1 {
+		s.next++
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDump(string(b))
+}
+
+// ParseDump parses the goroutines of a stack dump. Anything that is not a
+// goroutine, such as a panic message, is skipped. Goroutines which cannot
+// be parsed are left out and reported in the returned error.
+func ParseDump(dump string) ([]Goroutine, error) {
+	return compactParsed(parseBlocks(dumpBlocks(dump), func(_ int, block string) (Goroutine, error) {
+		return parseBlock(block)
+	}))
+}
+
+// dumpBlocks returns the text of every goroutine of dump.
+func dumpBlocks(dump string) []string {
+	dump = strings.Replace(dump, "\r\n", "\n", -1)
+	var blocks []string
+	for _, block := range strings.Split(dump, "\n\n") {
+		block = strings.TrimSpace(block)
+		// a panic message may directly precede the first goroutine
+		if i := strings.Index(block, "goroutine "); i > 0 && block[i-1] == '\n' {
+			block = block[i:]
+		}
+		// goroutine 0 is the scheduler stack of a thread, which crash
+		// tracebacks print
+		if !strings.HasPrefix(block, "goroutine ") || strings.HasPrefix(block, "goroutine 0 ") {
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// parallelBlocks is the number of goroutines from which dumps are parsed
+// by several workers.
+const parallelBlocks = 1024
+
+// parseBlocks parses blocks with parse, which is given the index of the
+// block and must be safe for concurrent use, and returns the goroutine and
+// error of each block. Large dumps are split among up to GOMAXPROCS
+// workers.
+func parseBlocks(blocks []string, parse func(i int, block string) (Goroutine, error)) ([]Goroutine, []error) {
+	gs := make([]Goroutine, len(blocks))
+	errs := make([]error, len(blocks))
+	workers := runtime.GOMAXPROCS(0)
+	if len(blocks) < parallelBlocks || workers < 2 {
+		workers = 1
+	}
+	chunk := (len(blocks) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for lo := 0; lo < len(blocks); lo += chunk {
+		hi := min(lo+chunk, len(blocks))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				gs[i], errs[i] = parse(i, blocks[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return gs, errs
+}
+
+// compactParsed leaves out the goroutines of parseBlocks which failed to
+// parse and joins their errors.
+func compactParsed(gs []Goroutine, errs []error) ([]Goroutine, error) {
+	parsed := gs[:0]
+	for i := range gs {
+		if errs[i] == nil {
+			parsed = append(parsed, gs[i])
+		}
+	}
+	return parsed, errors.Join(errs...)
+}
+
+// parseBlock parses the block of a single goroutine.
+func parseBlock(block string) (Goroutine, error) {
+	return parseGoroutine(plainTraceback(block))
+}
+
+func parseGoroutine(g string) (Goroutine, error) {
+	sl := strings.SplitN(g, "\n", 2)
+	if len(sl) != 2 {
+		return Goroutine{}, fmt.Errorf("error parsing stack: %q", g)
+	}
+
+	// Parse the goroutine's ID from the header line.
+	h := strings.SplitN(sl[0], " ", 3)
+	if len(h) < 3 {
+		return Goroutine{}, fmt.Errorf("error parsing stack header: %q", sl[0])
+	}
+	id, err := strconv.ParseUint(h[1], 10, 64)
+	if err != nil {
+		return Goroutine{}, fmt.Errorf("error parsing goroutine id: %s", err)
+	}
+
+	return Goroutine{
+		ID:        id,
+		State:     headerState(h[2]),
+		Wait:      headerWait(h[2]),
+		Labels:    headerLabels(h[2]),
+		Frames:    parseFrames(sl[1]),
+		CreatedBy: creatorFunc(g),
+		Stack:     g,
+	}, nil
+}
+
+// plainTraceback rewrites a goroutine of a crash traceback, as printed
+// on SIGQUIT or with GOTRACEBACK=system, like a plain one: without the
+// frame and stack pointers, the runtime frames a user goroutine is parked
+// in, and the runtime.goexit frame.
+func plainTraceback(g string) string {
+	crash := strings.Contains(g, " fp=0x")
+	if !crash && !strings.Contains(g, "\nruntime.goexit(") {
+		return g
+	}
+	lines := strings.Split(g, "\n")
+	// the runtime frames of a goroutine running user code are hidden
+	hide := crash && hasUserFrame(lines[1:])
+	out := lines[:0]
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "runtime.goexit(") || hide && hiddenRuntimeFrame(line) {
+			// and its location line
+			i++
+			continue
+		}
+		if j := strings.Index(line, " fp=0x"); j >= 0 && strings.HasPrefix(line, "\t") {
+			line = line[:j]
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// hasUserFrame reports whether the traceback lines have a frame outside
+// of the runtime.
+func hasUserFrame(lines []string) bool {
+	for _, line := range lines {
+		if line == "" || line[0] == '\t' || strings.HasPrefix(line, "created by ") {
+			continue
+		}
+		if !strings.HasPrefix(line, "runtime.") && !strings.HasPrefix(line, "internal/runtime/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenRuntimeFrame reports whether a frame line is left out of plain
+// tracebacks: unexported runtime functions other than gopanic.
+func hiddenRuntimeFrame(line string) bool {
+	if strings.HasPrefix(line, "internal/runtime/") {
+		return true
+	}
+	fn, ok := strings.CutPrefix(line, "runtime.")
+	if !ok || strings.HasPrefix(fn, "gopanic(") {
+		return false
+	}
+	return fn != "" && !unicode.IsUpper(rune(fn[0]))
+}
+
+// parseFrames parses the frames of a stack without its header line, up to
+// the "created by" line or the first ancestor traceback.
+func parseFrames(stack string) []Frame {
+	var frames []Frame
+	for _, line := range strings.Split(stack, "\n") {
+		switch {
+		case strings.HasPrefix(line, "created by "), strings.HasPrefix(line, "[originating from"):
+			return frames
+		case strings.HasPrefix(line, "\t"):
+			if len(frames) == 0 {
+				continue
+			}
+			f := &frames[len(frames)-1]
+			loc := strings.TrimSpace(line)
+			if i := strings.LastIndex(loc, " +0x"); i >= 0 {
+				loc = loc[:i]
+			}
+			if i := strings.LastIndexByte(loc, ':'); i >= 0 {
+				f.File = loc[:i]
+				f.Line, _ = strconv.Atoi(loc[i+1:])
+			}
+		case line == "" || strings.HasPrefix(line, "..."):
+		default:
+			fn := line
+			if i := strings.LastIndexByte(fn, '('); i > 0 {
+				fn = fn[:i]
+			}
+			frames = append(frames, Frame{Func: fn})
+		}
+	}
+	return frames
+}
+
+// body returns the stack without its header line.
+func (g *Goroutine) body() string {
+	if i := strings.IndexByte(g.Stack, '\n'); i >= 0 {
+		return strings.TrimSpace(g.Stack[i+1:])
+	}
+	return ""
+}
@@ -0,0 +1,289 @@
+package goleaker
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parsed is the part of a Goroutine the parser tests compare.
+type parsed struct {
+	ID        uint64
+	State     string
+	Wait      time.Duration
+	Labels    map[string]string
+	Frames    []Frame
+	CreatedBy string
+	Creator   uint64
+}
+
+func parsedOf(gs []Goroutine) []parsed {
+	var ps []parsed
+	for _, g := range gs {
+		creator, _ := creatorGoroutine(g.Stack)
+		ps = append(ps, parsed{g.ID, g.State, g.Wait, g.Labels, g.Frames, g.CreatedBy, creator})
+	}
+	return ps
+}
+
+const plainDump = `goroutine 7 [chan receive, 2 minutes]:
+main.block(...)
+	/tmp/crash/main.go:9
+main.main.gowrap1()
+	/tmp/crash/main.go:13 +0x19
+created by main.main in goroutine 1
+	/tmp/crash/main.go:13 +0x6a
+`
+
+// crashDump is the start of a traceback of an unrecovered panic with
+// GOTRACEBACK=system and GODEBUG=tracebacklabels=1.
+const crashDump = `panic: boom
+
+goroutine 1 gp=0x1b255b69e1e0 m=0 mp=0x596660 [running]:
+panic({0x57a650?, 0x4b7d50?})
+	/usr/local/go/src/runtime/panic.go:878 +0x159 fp=0x1b255b6e8e40 sp=0x1b255b6e8d98 pc=0x478d39
+main.main()
+	/tmp/crash/main.go:18 +0xf9 fp=0x1b255b6e8eb8 sp=0x1b255b6e8e40 pc=0x4ad6b9
+runtime.main()
+	/usr/local/go/src/runtime/proc.go:302 +0x427 fp=0x1b255b6e8fe0 sp=0x1b255b6e8eb8 pc=0x447807
+runtime.goexit({})
+	/usr/local/go/src/runtime/asm_amd64.s:1264 +0x1 fp=0x1b255b6e8fe8 sp=0x1b255b6e8fe0 pc=0x47ea01
+
+goroutine 0 gp=0x596a40 m=0 mp=0x596660 [idle]:
+runtime.futex(0x596798, 0x80, 0x0, 0x0, 0x0, 0x0)
+	/usr/local/go/src/runtime/sys_linux_amd64.s:557 +0x21 fp=0x7ffd3e5c0e58 sp=0x7ffd3e5c0e50 pc=0x480101
+
+goroutine 2 gp=0x1b255b69e780 m=nil [force gc (idle)]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca fp=0x1b255b6d0fa8 sp=0x1b255b6d0f88 pc=0x4791aa
+runtime.goparkunlock(...)
+	/usr/local/go/src/runtime/proc.go:480
+runtime.forcegchelper()
+	/usr/local/go/src/runtime/proc.go:387 +0xb3 fp=0x1b255b6d0fe0 sp=0x1b255b6d0fa8 pc=0x447ad3
+runtime.goexit({})
+	/usr/local/go/src/runtime/asm_amd64.s:1264 +0x1 fp=0x1b255b6d0fe8 sp=0x1b255b6d0fe0 pc=0x47ea01
+created by runtime.init.7 in goroutine 1
+	/usr/local/go/src/runtime/proc.go:375 +0x1a
+
+goroutine 7 gp=0xbc6ce9bf4a0 m=nil [chan receive] {k: "v w"}:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca fp=0xbc6ce9f2f20 sp=0xbc6ce9f2f00 pc=0x4791aa
+runtime.chanrecv(0xbc6cea200e0, 0x0, 0x1)
+	/usr/local/go/src/runtime/chan.go:667 +0x4ae fp=0xbc6ce9f2f98 sp=0xbc6ce9f2f20 pc=0x41460e
+runtime.chanrecv1(0x0?, 0x0?)
+	/usr/local/go/src/runtime/chan.go:509 +0x12 fp=0xbc6ce9f2fc0 sp=0xbc6ce9f2f98 pc=0x414152
+main.block(...)
+	/tmp/crash/main.go:9
+main.main.func1.gowrap1()
+	/tmp/crash/main.go:15 +0x19 fp=0xbc6ce9f2fe0 sp=0xbc6ce9f2fc0 pc=0x4ad779
+runtime.goexit({})
+	/usr/local/go/src/runtime/asm_amd64.s:1264 +0x1 fp=0xbc6ce9f2fe8 sp=0xbc6ce9f2fe0 pc=0x47ea01
+created by main.main.func1 in goroutine 1
+	/tmp/crash/main.go:15 +0x5f
+`
+
+func TestParseDump(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		want []parsed
+	}{
+		{"plain", plainDump, []parsed{{
+			ID: 7, State: "chan receive", Wait: 2 * time.Minute,
+			Frames: []Frame{
+				{Func: "main.block", File: "/tmp/crash/main.go", Line: 9},
+				{Func: "main.main.gowrap1", File: "/tmp/crash/main.go", Line: 13},
+			},
+			CreatedBy: "main.main", Creator: 1,
+		}}},
+		{"crlf", strings.Replace(plainDump, "\n", "\r\n", -1), []parsed{{
+			ID: 7, State: "chan receive", Wait: 2 * time.Minute,
+			Frames: []Frame{
+				{Func: "main.block", File: "/tmp/crash/main.go", Line: 9},
+				{Func: "main.main.gowrap1", File: "/tmp/crash/main.go", Line: 13},
+			},
+			CreatedBy: "main.main", Creator: 1,
+		}}},
+		{"labels", `goroutine 8 [select] {goleaker.context: 3, k: "v w", "a, b": c}:
+main.serve()
+	/tmp/main.go:20 +0x19
+created by main.main in goroutine 1
+	/tmp/main.go:10 +0x6a
+`, []parsed{{
+			ID: 8, State: "select",
+			Labels:    map[string]string{"goleaker.context": "3", "k": "v w", "a, b": "c"},
+			Frames:    []Frame{{Func: "main.serve", File: "/tmp/main.go", Line: 20}},
+			CreatedBy: "main.main", Creator: 1,
+		}}},
+		{"created by before Go 1.21", `goroutine 9 [IO wait]:
+main.read(0xc000010000)
+	/tmp/main.go:30 +0x25
+created by main.main
+	/tmp/main.go:12 +0x6a
+`, []parsed{{
+			ID: 9, State: "IO wait",
+			Frames:    []Frame{{Func: "main.read", File: "/tmp/main.go", Line: 30}},
+			CreatedBy: "main.main",
+		}}},
+		{"ancestors and elided frames", `goroutine 10 [chan send]:
+main.deep(...)
+	/tmp/main.go:40
+...additional frames elided...
+created by main.spawn in goroutine 5
+	/tmp/main.go:20 +0x6a
+[originating from goroutine 5]:
+main.spawn(...)
+	/tmp/main.go:20
+`, []parsed{{
+			ID: 10, State: "chan send",
+			Frames:    []Frame{{Func: "main.deep", File: "/tmp/main.go", Line: 40}},
+			CreatedBy: "main.spawn", Creator: 5,
+		}}},
+		{"crash", crashDump, []parsed{
+			{
+				ID: 1, State: "running",
+				Frames: []Frame{
+					{Func: "panic", File: "/usr/local/go/src/runtime/panic.go", Line: 878},
+					{Func: "main.main", File: "/tmp/crash/main.go", Line: 18},
+				},
+			},
+			{
+				ID: 2, State: "force gc (idle)",
+				Frames: []Frame{
+					{Func: "runtime.gopark", File: "/usr/local/go/src/runtime/proc.go", Line: 474},
+					{Func: "runtime.goparkunlock", File: "/usr/local/go/src/runtime/proc.go", Line: 480},
+					{Func: "runtime.forcegchelper", File: "/usr/local/go/src/runtime/proc.go", Line: 387},
+				},
+				CreatedBy: "runtime.init.7", Creator: 1,
+			},
+			{
+				ID: 7, State: "chan receive",
+				Labels: map[string]string{"k": "v w"},
+				Frames: []Frame{
+					{Func: "main.block", File: "/tmp/crash/main.go", Line: 9},
+					{Func: "main.main.func1.gowrap1", File: "/tmp/crash/main.go", Line: 15},
+				},
+				CreatedBy: "main.main.func1", Creator: 1,
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs, err := ParseDump(tt.dump)
+			if err != nil {
+				t.Fatalf("ParseDump: %v", err)
+			}
+			if got := parsedOf(gs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDump =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDumpErrors(t *testing.T) {
+	gs, err := ParseDump("goroutine x [running]:\nmain.main()\n\n" + plainDump)
+	if err == nil || !strings.Contains(err.Error(), "goroutine id") {
+		t.Errorf("ParseDump error = %v, want it to name the goroutine id", err)
+	}
+	if len(gs) != 1 || gs[0].ID != 7 {
+		t.Errorf("ParseDump = %+v, want goroutine 7 still parsed", parsedOf(gs))
+	}
+}
+
+func TestPlainTraceback(t *testing.T) {
+	gs, err := ParseDump(crashDump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `goroutine 7 gp=0xbc6ce9bf4a0 m=nil [chan receive] {k: "v w"}:
+main.block(...)
+	/tmp/crash/main.go:9
+main.main.func1.gowrap1()
+	/tmp/crash/main.go:15 +0x19
+created by main.main.func1 in goroutine 1
+	/tmp/crash/main.go:15 +0x5f`
+	if got := gs[len(gs)-1].Stack; got != want {
+		t.Errorf("crash traceback rewritten as\n%s\nwant\n%s", got, want)
+	}
+	if got := plainTraceback(plainDump); got != plainDump {
+		t.Errorf("plain traceback rewritten as\n%s", got)
+	}
+}
+
+func TestExiting(t *testing.T) {
+	tests := []struct {
+		name, dump string
+		want       bool
+	}{
+		{"dead", `goroutine 5 [dead]:
+main.worker()
+	/tmp/main.go:9 +0x19
+`, true},
+		{"in goexit0", `goroutine 5 [running]:
+runtime.goexit0(0xc000007c00)
+	/usr/local/go/src/runtime/proc.go:4300 +0x1e
+runtime.mcall()
+	/usr/local/go/src/runtime/asm_amd64.s:459 +0x4e
+`, true},
+		{"parked on the way out", `goroutine 5 [runnable]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca
+runtime.gdestroy(0xc000007c00)
+	/usr/local/go/src/runtime/proc.go:4350 +0x1e
+`, true},
+		{"ends in goexit", `goroutine 5 [chan receive]:
+main.block(...)
+	/tmp/main.go:9
+runtime.goexit({})
+	/usr/local/go/src/runtime/asm_amd64.s:1264 +0x1
+created by main.main in goroutine 1
+	/tmp/main.go:13 +0x6a
+`, false},
+		{"calls a goexit lookalike", `goroutine 5 [select]:
+main.(*worker).goexit0()
+	/tmp/main.go:9 +0x19
+`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs, err := ParseDump(tt.dump)
+			if err != nil || len(gs) != 1 {
+				t.Fatalf("ParseDump = %d goroutines, %v", len(gs), err)
+			}
+			if got := exiting(&gs[0]); got != tt.want {
+				t.Errorf("exiting = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// largeDump returns a dump of n goroutines, each with its own frames.
+func largeDump(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "goroutine %d [select]:\nmain.worker%d()\n\t/tmp/main.go:%d +0x19\ncreated by main.main in goroutine 1\n\t/tmp/main.go:10 +0x6a\n\n", i, i, i)
+	}
+	return b.String()
+}
+
+func TestParseDumpParallel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	n := 3*parallelBlocks + 7
+	gs, err := ParseDump(largeDump(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gs) != n {
+		t.Fatalf("ParseDump = %d goroutines, want %d", len(gs), n)
+	}
+	for i, g := range gs {
+		id := uint64(i + 1)
+		want := Frame{Func: fmt.Sprintf("main.worker%d", id), File: "/tmp/main.go", Line: int(id)}
+		if g.ID != id || len(g.Frames) != 1 || g.Frames[0] != want {
+			t.Fatalf("goroutine %d parsed as %+v, want id %d with frame %+v", i, parsedOf(gs[i:i+1]), id, want)
+		}
+	}
+}
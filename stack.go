@@ -0,0 +1,242 @@
+package goleaker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// selfPackage is the import path of this package as it appears in stacks.
+var selfPackage = funcPackage(runtime.FuncForPC(reflect.ValueOf(newOptions).Pointer()).Name())
+
+// creatorFunc returns the function named in the "created by" line of a
+// goroutine stack, or "" if there is none.
+func creatorFunc(stack string) string {
+	i := strings.Index(stack, "\ncreated by ")
+	if i < 0 {
+		return ""
+	}
+	line := stack[i+len("\ncreated by "):]
+	if j := strings.IndexByte(line, '\n'); j >= 0 {
+		line = line[:j]
+	}
+	if j := strings.Index(line, " in goroutine "); j >= 0 {
+		line = line[:j]
+	}
+	return strings.TrimSpace(line)
+}
+
+// creatorGoroutine returns the id of the goroutine named in the "created
+// by" line of a goroutine stack, which the runtime prints since Go 1.21.
+func creatorGoroutine(stack string) (uint64, bool) {
+	i := strings.Index(stack, "\ncreated by ")
+	if i < 0 {
+		return 0, false
+	}
+	line := stack[i+1:]
+	if j := strings.IndexByte(line, '\n'); j >= 0 {
+		line = line[:j]
+	}
+	j := strings.Index(line, " in goroutine ")
+	if j < 0 {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(line[j+len(" in goroutine "):]), 10, 64)
+	return id, err == nil
+}
+
+// funcPackage returns the import path of a fully qualified function name
+// as printed in a traceback, e.g. "net/http.(*persistConn).readLoop"
+// yields "net/http".
+func funcPackage(fn string) string {
+	slash := strings.LastIndexByte(fn, '/')
+	dot := strings.IndexByte(fn[slash+1:], '.')
+	if dot < 0 {
+		return fn
+	}
+	// the linker escapes dots in the last path element
+	return strings.Replace(fn[:slash+1+dot], "%2e", ".", -1)
+}
+
+// stackFuncs returns the function names of every frame in a goroutine
+// stack, including "created by" lines and ancestor tracebacks.
+func stackFuncs(stack string) []string {
+	var fns []string
+	for _, line := range strings.Split(stack, "\n") {
+		if line == "" || line[0] == '\t' || line[0] == '[' || strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+		if strings.HasPrefix(line, "created by ") {
+			line = strings.TrimPrefix(line, "created by ")
+			if i := strings.Index(line, " in goroutine "); i >= 0 {
+				line = line[:i]
+			}
+		} else if i := strings.LastIndexByte(line, '('); i > 0 {
+			line = line[:i]
+		}
+		fns = append(fns, strings.TrimSpace(line))
+	}
+	return fns
+}
+
+// CurrentGoroutineID returns the id of the calling goroutine, as printed
+// in stack dumps.
+func CurrentGoroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// "goroutine 7 [running]:"
+	fields := strings.Fields(string(buf))
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(fields[1], 10, 64)
+	return id
+}
+
+// currentTestFunc returns the test function run by testing.tRunner on the
+// calling goroutine, or "" when not called from a test.
+func currentTestFunc() string {
+	pcs := make([]uintptr, 128)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	var prev string
+	for {
+		f, more := frames.Next()
+		if f.Function == "testing.tRunner" {
+			return prev
+		}
+		prev = f.Function
+		if !more {
+			return ""
+		}
+	}
+}
+
+// passesThrough reports whether fn or one of its closures appears in stack.
+func passesThrough(stack, fn string) bool {
+	for _, f := range stackFuncs(stack) {
+		if f == fn || strings.HasPrefix(f, fn+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// headerState returns the wait reason from the bracketed part of a
+// goroutine header, e.g. "chan receive" for "[chan receive, 2 minutes]:".
+func headerState(header string) string {
+	i := strings.IndexByte(header, '[')
+	j := strings.IndexByte(header, ']')
+	if i < 0 || j < i {
+		return ""
+	}
+	state := header[i+1 : j]
+	if k := strings.IndexByte(state, ','); k >= 0 {
+		state = state[:k]
+	}
+	return state
+}
+
+// headerWait returns how long a goroutine has been blocked according to
+// its header, e.g. 2m for "[chan receive, 2 minutes]:".
+func headerWait(header string) time.Duration {
+	i := strings.IndexByte(header, '[')
+	j := strings.IndexByte(header, ']')
+	if i < 0 || j < i {
+		return 0
+	}
+	for _, part := range strings.Split(header[i+1:j], ", ") {
+		if !strings.HasSuffix(part, " minutes") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(part, " minutes")); err == nil {
+			return time.Duration(n) * time.Minute
+		}
+	}
+	return 0
+}
+
+// headerLabels returns the pprof labels of a goroutine header, e.g.
+// {"k": "v w"} for `[sleep] {k: "v w"}:`.
+func headerLabels(header string) map[string]string {
+	i := strings.Index(header, "] {")
+	if i < 0 {
+		return nil
+	}
+	s := strings.TrimSuffix(strings.TrimSpace(header[i+3:]), ":")
+	s = strings.TrimSuffix(s, "}")
+	labels := map[string]string{}
+	for s != "" {
+		k, rest, ok := labelToken(s, ": ")
+		if !ok {
+			break
+		}
+		v, rest, _ := labelToken(rest, ", ")
+		labels[k] = v
+		s = rest
+	}
+	return labels
+}
+
+// labelToken splits a possibly quoted token off s up to sep.
+func labelToken(s, sep string) (string, string, bool) {
+	if strings.HasPrefix(s, `"`) {
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", false
+		}
+		tok, _ := strconv.Unquote(q)
+		rest, ok := strings.CutPrefix(s[len(q):], sep)
+		return tok, rest, ok || s[len(q):] == ""
+	}
+	tok, rest, ok := strings.Cut(s, sep)
+	return tok, rest, ok || tok != ""
+}
+
+// signature normalizes a goroutine stack so goroutines parked at the same
+// place compare equal: the header, arguments, pc offsets and goroutine ids
+// are dropped.
+func signature(stack string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(stack, "\n") {
+		switch {
+		case strings.HasPrefix(line, "goroutine "):
+			continue
+		case strings.HasPrefix(line, "\t"):
+			if i := strings.LastIndex(line, " +0x"); i >= 0 {
+				line = line[:i]
+			}
+		case strings.HasPrefix(line, "created by "):
+			if i := strings.Index(line, " in goroutine "); i >= 0 {
+				line = line[:i]
+			}
+		default:
+			if i := strings.LastIndexByte(line, '('); i > 0 {
+				line = line[:i]
+			}
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// SignatureID returns a short hash identifying the goroutine's signature,
+// for referencing a leak from dashboards, config files and issues. Only
+// function names are hashed, so the ID survives moved lines, another
+// GOROOT and most Go upgrades.
+func (g *Goroutine) SignatureID() string {
+	return signatureID(g.Stack)
+}
+
+func signatureID(stack string) string {
+	h := sha256.New()
+	for _, fn := range stackFuncs(stack) {
+		h.Write([]byte(fn))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
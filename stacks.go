@@ -0,0 +1,31 @@
+//go:build !tinygo
+
+package goleaker
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// FullStacks reports whether the runtime dumps the stacks of every
+// goroutine, which only TinyGo does not, among the supported toolchains.
+// Without stacks checks degrade to comparing the number of goroutines:
+// rules and reports see anonymous goroutines without frames.
+const FullStacks = true
+
+func captureStacks(c *parseCache) ([]Goroutine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.buf == nil {
+		c.buf = make([]byte, 2<<20)
+	}
+	for {
+		n := runtime.Stack(c.buf, true)
+		if n < len(c.buf) {
+			// the cache clones what it keeps, so the buffer can be
+			// reused without copying the dump
+			return c.parse(unsafe.String(&c.buf[0], n))
+		}
+		c.buf = make([]byte, 2*len(c.buf))
+	}
+}
@@ -0,0 +1,88 @@
+package goleaker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SubprocessDumpTimeout is how long CheckSubprocess waits for a process
+// to dump its goroutines and exit before killing it.
+var SubprocessDumpTimeout = 5 * time.Second
+
+// CheckSubprocess runs cmd, typically another Go binary or test binary of
+// an integration test, with GOTRACEBACK=all and waits up to timeout for it
+// to exit. If it is still running, it is sent SIGQUIT, and the goroutines
+// of the dump the Go runtime writes to its stderr are reported unless the
+// options ignore them. Where there is no SIGQUIT the process is killed and
+// no goroutines are reported. The returned error is the one of cmd.Wait.
+func CheckSubprocess(t ErrorReporter, cmd *exec.Cmd, timeout time.Duration, opts ...Option) error {
+	o := newOptions(opts)
+	t = o.reporter(t)
+	if name := testName(t); name != "" {
+		t = namedReporter{ErrorReporter: t, name: name}
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env[:len(env):len(env)], "GOTRACEBACK=all")
+	var stderr bytes.Buffer
+	if cmd.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, &stderr)
+	} else {
+		cmd.Stderr = &stderr
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+	if quitProcess(cmd.Process) != nil {
+		cmd.Process.Kill()
+	}
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(SubprocessDumpTimeout):
+		cmd.Process.Kill()
+		err = <-done
+	}
+
+	all, perr := ParseDump(stderr.String())
+	if perr != nil {
+		t.Errorf("leaktest: %s", perr)
+	}
+	var running []*Goroutine
+	for i := range all {
+		if g := &all[i]; o.interesting(g) {
+			running = append(running, g)
+		}
+	}
+	sort.Sort(goroutines(running))
+	if len(all) == 0 {
+		o.reportFinding(t, Finding{Kind: "subprocess", Message: fmt.Sprintf("%s still running after %v, no goroutine dump", cmdName(cmd), timeout)})
+	} else if len(running) > 0 {
+		reportGoroutines(t, o, fmt.Sprintf("%s still running after %v, %d goroutine(s) in its dump", cmdName(cmd), timeout, len(running)),
+			running, len(all))
+	}
+	return err
+}
+
+// cmdName names cmd in reports.
+func cmdName(cmd *exec.Cmd) string {
+	return strings.Join(cmd.Args, " ")
+}
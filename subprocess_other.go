@@ -0,0 +1,12 @@
+//go:build !unix
+
+package goleaker
+
+import (
+	"errors"
+	"os"
+)
+
+func quitProcess(p *os.Process) error {
+	return errors.New("no SIGQUIT on this platform")
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package goleaker
+
+import (
+	"os"
+	"syscall"
+)
+
+// quitProcess makes the Go runtime of p dump its goroutines and exit.
+func quitProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGQUIT)
+}
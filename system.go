@@ -0,0 +1,83 @@
+package goleaker
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// SystemGoroutine names the function of a goroutine the runtime starts
+// for itself, along with the Go releases having it.
+type SystemGoroutine struct {
+	// Func is matched against every frame and the creation frame.
+	Func string
+	// Since and Until are the first and last Go 1.x minor versions with
+	// Func, zero for no bound.
+	Since, Until int
+}
+
+// SystemGoroutines are the goroutines of the runtime itself, which checks
+// never report. Entries for other Go releases than the running one are
+// skipped; append to or replace the list to cover another runtime.
+var SystemGoroutines = []SystemGoroutine{
+	{Func: "runtime.forcegchelper"},
+	{Func: "runtime.bgsweep", Since: 5},
+	{Func: "runtime.bgscavenge", Since: 13},
+	{Func: "runtime.gcBgMarkWorker", Since: 5},
+	{Func: "runtime.timerproc", Until: 13},
+	{Func: "runtime.runfinq", Until: 24},
+	{Func: "runtime.runFinalizers", Since: 25},
+	{Func: "runtime.runCleanups", Since: 25},
+	{Func: "runtime.updateMaxProcsGoroutine", Since: 25},
+	{Func: "runtime.ensureSigM.func1"},
+	{Func: "runtime.(*traceAdvancerState).start.func1", Since: 22},
+	{Func: "runtime.traceStartReadCPU.func1", Since: 21},
+	// the event loop of js/wasm, which parks JavaScript callbacks
+	{Func: "runtime.handleAsyncEvent", Since: 11},
+	{Func: "runtime.handleEvent", Since: 11},
+	{Func: "syscall/js.handleEvent", Since: 11},
+}
+
+// goMinor is the minor version of the running Go release, 0 if unknown.
+var goMinor = parseGoMinor(runtime.Version())
+
+func parseGoMinor(v string) int {
+	i := strings.Index(v, "go1.")
+	if i < 0 {
+		return 0
+	}
+	v = v[i+len("go1."):]
+	if j := strings.IndexFunc(v, func(r rune) bool { return r < '0' || r > '9' }); j >= 0 {
+		v = v[:j]
+	}
+	n, _ := strconv.Atoi(v)
+	return n
+}
+
+// systemGoroutine reports whether g belongs to the runtime: it has a frame
+// in one of the SystemGoroutines, or all of its frames, parked in some
+// runtime.gopark variant, are in the runtime.
+func systemGoroutine(g *Goroutine) bool {
+	for _, s := range SystemGoroutines {
+		if goMinor != 0 && (s.Since != 0 && goMinor < s.Since || s.Until != 0 && goMinor > s.Until) {
+			continue
+		}
+		if g.CreatedBy == s.Func {
+			return true
+		}
+		for _, f := range g.Frames {
+			if f.Func == s.Func {
+				return true
+			}
+		}
+	}
+	if len(g.Frames) == 0 || g.CreatedBy != "" && !strings.HasPrefix(g.CreatedBy, "runtime.") {
+		return false
+	}
+	for _, f := range g.Frames {
+		if !strings.HasPrefix(f.Func, "runtime.") {
+			return false
+		}
+	}
+	return true
+}
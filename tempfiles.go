@@ -0,0 +1,152 @@
+package goleaker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// tempFiles are the files and directories made by CreateTemp and
+// MkdirTemp, with the stacks that made them, until a check finds them
+// removed.
+var tempFiles struct {
+	sync.Mutex
+	stacks map[string]string
+}
+
+// CreateTemp is the same as os.CreateTemp, but records the stack creating
+// the file for CheckTempFiles to report if it is left behind.
+func CreateTemp(dir, pattern string) (*os.File, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err == nil {
+		trackTempFile(f.Name())
+	}
+	return f, err
+}
+
+// MkdirTemp is the same as os.MkdirTemp, but records the stack creating
+// the directory for CheckTempFiles to report if it is left behind.
+func MkdirTemp(dir, pattern string) (string, error) {
+	name, err := os.MkdirTemp(dir, pattern)
+	if err == nil {
+		trackTempFile(name)
+	}
+	return name, err
+}
+
+func trackTempFile(name string) {
+	stack := callerStack(4)
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	if tempFiles.stacks == nil {
+		tempFiles.stacks = map[string]string{}
+	}
+	tempFiles.stacks[name] = stack
+}
+
+// tempFileStacks returns the creation stacks of the tracked files by path,
+// and forgets the ones removed.
+func tempFileStacks() map[string]string {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	stacks := map[string]string{}
+	for name, stack := range tempFiles.stacks {
+		if _, err := os.Lstat(name); err != nil {
+			delete(tempFiles.stacks, name)
+			continue
+		}
+		stacks[name] = stack
+	}
+	return stacks
+}
+
+// CheckTempFiles snapshots the entries of os.TempDir and the files made by
+// CreateTemp and MkdirTemp, and returns a function to be run at the end of
+// tests which reports the temporary files and directories created since
+// that were not removed. The files of CreateTemp and MkdirTemp are
+// reported with the stack that made them, wherever they are. The
+// directories of t.TempDir, which the testing package removes after the
+// deferred functions of the test ran, do not count. Files other processes
+// or parallel tests create in os.TempDir show up as well, so the check
+// suits a TMPDIR private to the test binary best.
+func CheckTempFiles(t ErrorReporter, opts ...Option) func() {
+	o := newOptions(opts)
+	if o.testName = testName(t); o.testName != "" {
+		t = namedReporter{ErrorReporter: t, name: o.testName}
+	}
+	testDir := tempDirPattern(o.testName)
+	dir := os.TempDir()
+	before := map[string]bool{}
+	for _, name := range tempEntries(dir) {
+		before[name] = true
+	}
+	for name := range tempFileStacks() {
+		before[name] = true
+	}
+	return func() {
+		stacks := tempFileStacks()
+		left := map[string]bool{}
+		for _, name := range tempEntries(dir) {
+			if !before[name] && (testDir == "" || !strings.HasPrefix(filepath.Base(name), testDir)) {
+				left[name] = true
+			}
+		}
+		for name := range stacks {
+			if !before[name] {
+				left[name] = true
+			}
+		}
+		var names []string
+		for name := range left {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			kind := "file"
+			if fi, err := os.Lstat(name); err == nil && fi.IsDir() {
+				kind = "directory"
+			}
+			o.reportFinding(t, Finding{Kind: "temporary " + kind, Message: fmt.Sprintf("temporary %s %s was not removed", kind, name), Stack: stacks[name]})
+		}
+	}
+}
+
+// tempEntries returns the absolute paths of the entries of dir.
+func tempEntries(dir string) []string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = filepath.Join(dir, e.Name())
+	}
+	return names
+}
+
+// tempDirPattern returns the prefix of the directory t.TempDir creates in
+// os.TempDir for the test named name, "" without a name or when GOTMPDIR
+// moves it elsewhere.
+func tempDirPattern(name string) string {
+	if name == "" || os.Getenv("GOTMPDIR") != "" {
+		return ""
+	}
+	// as the testing package, dropping the characters it drops
+	name = name[:min(len(name), 64)]
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || strings.ContainsRune("!#$%&()+,-.=@^_{}~ ", r) {
+			return r
+		}
+		return -1
+	}, name)
+}
@@ -0,0 +1,92 @@
+package goleaker
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The test attributes a failed check records when its ErrorReporter has
+// the Attr method of testing.T, which go test -json reports as "attr"
+// events: the number of leaked goroutines and the comma separated
+// signatures and classes of the leaks.
+const (
+	AttrLeaked     = "goleaker.leaked"
+	AttrSignatures = "goleaker.signatures"
+	AttrClasses    = "goleaker.classes"
+)
+
+// recordAttrs records the leak attributes of the groups on t.
+func recordAttrs(t ErrorReporter, groups []*group) {
+	a, ok := t.(interface{ Attr(key, value string) })
+	if !ok {
+		return
+	}
+	var n int
+	var sigs, classes []string
+	seen := map[LeakClass]bool{}
+	for _, gr := range groups {
+		n += len(gr.goroutines)
+		sigs = append(sigs, gr.id)
+		if !seen[gr.class] {
+			seen[gr.class] = true
+			classes = append(classes, string(gr.class))
+		}
+	}
+	a.Attr(AttrLeaked, strconv.Itoa(n))
+	a.Attr(AttrSignatures, strings.Join(sigs, ","))
+	a.Attr(AttrClasses, strings.Join(classes, ","))
+}
+
+// test2json reports whether the test binary runs under go test -json,
+// which sets -test.v=test2json.
+func test2json() bool {
+	f := flag.Lookup("test.v")
+	return f != nil && f.Value.String() == "test2json"
+}
+
+// testFrames attributes the leaks VerifyTestMain reports once all tests
+// ran to the tests that started them, by writing the framing lines of
+// test2json ahead of each report, so go test -json shows them on the
+// output of the tests along with their attributes. It does nothing unless
+// reports are attributed and the binary runs under go test -json.
+type testFrames struct {
+	w      io.Writer
+	counts map[string]int
+	order  []string
+}
+
+func (o *options) testFrames() *testFrames {
+	if !o.attribute || !test2json() {
+		return nil
+	}
+	// testing points os.Stderr at os.Stdout under test2json
+	return &testFrames{w: os.Stdout, counts: map[string]int{}}
+}
+
+// frame attributes the output following it to the test which started g.
+func (f *testFrames) frame(g *Goroutine) {
+	if f == nil {
+		return
+	}
+	name := attributeTest(g)
+	if f.counts[name]++; f.counts[name] == 1 && name != "" {
+		f.order = append(f.order, name)
+	}
+	fmt.Fprintf(f.w, "\x16=== NAME  %s\n", name)
+}
+
+// close records the leaked attribute of every test framed and attributes
+// further output to the package again.
+func (f *testFrames) close() {
+	if f == nil {
+		return
+	}
+	for _, name := range f.order {
+		fmt.Fprintf(f.w, "\x16=== ATTR  %s %s %d\n", name, AttrLeaked, f.counts[name])
+	}
+	fmt.Fprintf(f.w, "\x16=== NAME  \n")
+}
@@ -0,0 +1,72 @@
+package goleaker
+
+import (
+	"flag"
+	"os"
+	"time"
+)
+
+// TestMainGracePeriod is how long VerifyTestMain waits for goroutines to
+// exit once all tests ran.
+var TestMainGracePeriod = time.Second
+
+// VerifyTestMain runs the tests of m, checks for goroutines they leaked and
+// exits. Unless a test failed, leaks are printed to stderr, each
+// attributed to the test which most likely started it, and make the test
+// binary fail. Attribution needs the test function on the stack of the
+// goroutine or, for goroutines started with Go, tests running a check of
+// their own, since only checks record when tests ran. The grace period
+// ends TestDeadlineMargin before the -test.timeout of the binary runs
+// out, and with no time left, the leaks still running are reported at
+// once:
+//
+//	func TestMain(m *testing.M) {
+//		goleaker.VerifyTestMain(m)
+//	}
+func VerifyTestMain(m interface{ Run() int }, opts ...Option) {
+	c := &countingReporter{ErrorReporter: stderrReporter{}}
+	opts = append(opts[:len(opts):len(opts)], withAttribution(), withBinaryDeadline(time.Now()))
+	check := CheckTimeout(c, scaled(TestMainGracePeriod), opts...)
+	code := m.Run()
+	if code == 0 {
+		check()
+		if c.n > 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+func withAttribution() Option {
+	return func(o *options) {
+		o.attribute = true
+	}
+}
+
+// withBinaryDeadline bounds the grace period by the -test.timeout of a
+// test binary whose tests started running at start. The flag is only
+// parsed once the tests run, so its deadline is looked up when the grace
+// period starts.
+func withBinaryDeadline(start time.Time) Option {
+	return func(o *options) {
+		o.binaryStart = start
+	}
+}
+
+// binaryDeadline returns when the -test.timeout of a test binary started
+// at start runs out, less TestDeadlineMargin.
+func binaryDeadline(start time.Time) (time.Time, bool) {
+	f := flag.Lookup("test.timeout")
+	if f == nil {
+		return time.Time{}, false
+	}
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return time.Time{}, false
+	}
+	timeout, ok := g.Get().(time.Duration)
+	if !ok || timeout <= 0 {
+		return time.Time{}, false
+	}
+	return start.Add(timeout - TestDeadlineMargin), true
+}
@@ -0,0 +1,121 @@
+package goleaker
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// testName returns the name of t if it has testing.TB's Name method.
+func testName(t ErrorReporter) string {
+	if n, ok := t.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return ""
+}
+
+// namedReporter puts the test name into every leaktest message, so leaks
+// can be told apart in aggregated logs.
+type namedReporter struct {
+	ErrorReporter
+	name string
+}
+
+func (r namedReporter) Errorf(format string, args ...interface{}) {
+	if rest, ok := strings.CutPrefix(format, "leaktest: "); ok {
+		format = "leaktest: %s: " + rest
+		args = append([]interface{}{r.name}, args...)
+	}
+	r.ErrorReporter.Errorf(format, args...)
+}
+
+func (r namedReporter) Failed() bool {
+	return failed(r.ErrorReporter)
+}
+
+func (r namedReporter) Attr(key, value string) {
+	if a, ok := r.ErrorReporter.(interface{ Attr(key, value string) }); ok {
+		a.Attr(key, value)
+	}
+}
+
+func (r namedReporter) Logf(format string, args ...interface{}) {
+	logf(r.ErrorReporter, format, args...)
+}
+
+// testRun is the time window of a test which ran a check. The testing
+// package tells nobody when other tests run.
+type testRun struct {
+	name       string
+	start, end time.Time
+}
+
+var testRuns struct {
+	sync.Mutex
+	runs []testRun
+}
+
+func recordTestRun(name string, start time.Time) {
+	testRuns.Lock()
+	defer testRuns.Unlock()
+	testRuns.runs = append(testRuns.runs, testRun{name: name, start: start, end: time.Now()})
+}
+
+// attributeTest returns the test which most likely started g: the test
+// function in its stack, or else the tests that ran a check while g was
+// created according to its CreatedLabel, or the last one started before.
+// It returns "" for goroutines with neither, such as the ones started by
+// a test through a package-level worker.
+func attributeTest(g *Goroutine) string {
+	for _, fn := range stackFuncs(g.Stack) {
+		name := fn[strings.LastIndexByte(fn, '/')+1:]
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[i+1:]
+		}
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[:i]
+		}
+		if isTestFunc(name) {
+			return name
+		}
+	}
+	created, ok := g.Created()
+	if !ok {
+		return ""
+	}
+	testRuns.Lock()
+	defer testRuns.Unlock()
+	var names []string
+	last := ""
+	for _, r := range testRuns.runs {
+		if r.start.After(created) {
+			continue
+		}
+		last = r.name
+		if !r.end.Before(created) {
+			names = append(names, r.name)
+		}
+	}
+	if len(names) == 0 && last != "" {
+		names = append(names, last)
+	}
+	return strings.Join(names, ", ")
+}
+
+// isTestFunc reports whether name is the name of a test, benchmark, fuzz
+// test or example function.
+func isTestFunc(name string) bool {
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		r, _ := utf8.DecodeRuneInString(rest)
+		if rest == "" || !unicode.IsLower(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package goleaker
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// tickerSite is where the time.Ticker a goroutine selects on was created.
+type tickerSite struct {
+	File string
+	Line int
+}
+
+// tickerSelect reports whether g is blocked in a select whose only cases
+// receive from time.Ticker channels, so nothing but the ticker can ever
+// wake it, and where the ticker was created. It reads the source of the
+// select, which has to be on disk at the path in the stack; without it,
+// nothing is detected.
+func tickerSelect(g *Goroutine) (tickerSite, bool) {
+	// a select with a single case compiles to a plain receive
+	if g.State != "select" && g.State != "chan receive" || len(g.Frames) == 0 {
+		return tickerSite{}, false
+	}
+	top := g.Frames[0]
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, top.File, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return tickerSite{}, false
+	}
+	timePkg := importName(file, "time")
+	if timePkg == "" {
+		return tickerSite{}, false
+	}
+	line := func(n ast.Node) int { return fset.Position(n.Pos()).Line }
+
+	var site tickerSite
+	found := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		fn, ok := n.(*ast.FuncDecl)
+		if found || !ok || fn.Body == nil || line(fn) > top.Line || fset.Position(fn.End()).Line < top.Line {
+			return !found
+		}
+		tickers := tickerVars(fn.Body, timePkg)
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectStmt)
+			if found || !ok || !selectAt(sel, top.Line, line) {
+				return !found
+			}
+			site, found = tickerCases(sel, tickers, timePkg, line)
+			if found {
+				site.File = top.File
+			}
+			return false
+		})
+		return false
+	})
+	return site, found
+}
+
+// selectAt reports whether a goroutine blocked in sel is shown at line:
+// the line of the select, or of the case of a single case select.
+func selectAt(sel *ast.SelectStmt, at int, line func(ast.Node) int) bool {
+	if line(sel) == at {
+		return true
+	}
+	return len(sel.Body.List) == 1 && line(sel.Body.List[0]) == at
+}
+
+// tickerVars maps the variables of body assigned a time.NewTicker or
+// time.Tick to the call. time.Tick returns the channel itself, which is
+// told apart by the key of its variable ending in "<-".
+func tickerVars(body *ast.BlockStmt, timePkg string) map[string]ast.Expr {
+	vars := map[string]ast.Expr{}
+	assign := func(id *ast.Ident, rhs ast.Expr) {
+		switch timeCall(rhs, timePkg) {
+		case "NewTicker":
+			vars[id.Name] = rhs
+		case "Tick":
+			vars[id.Name+"<-"] = rhs
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) == len(n.Rhs) {
+				for i, rhs := range n.Rhs {
+					if id, ok := n.Lhs[i].(*ast.Ident); ok {
+						assign(id, rhs)
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			if len(n.Names) == len(n.Values) {
+				for i, rhs := range n.Values {
+					assign(n.Names[i], rhs)
+				}
+			}
+		}
+		return true
+	})
+	return vars
+}
+
+// tickerCases returns the creation of the ticker of sel when every case of
+// sel receives from a ticker.
+func tickerCases(sel *ast.SelectStmt, tickers map[string]ast.Expr, timePkg string, line func(ast.Node) int) (tickerSite, bool) {
+	var site tickerSite
+	for _, stmt := range sel.Body.List {
+		cc := stmt.(*ast.CommClause)
+		if cc.Comm == nil {
+			// a default case never blocks
+			return tickerSite{}, false
+		}
+		var ch ast.Expr
+		switch comm := cc.Comm.(type) {
+		case *ast.ExprStmt:
+			ch = comm.X
+		case *ast.AssignStmt:
+			ch = comm.Rhs[0]
+		default:
+			return tickerSite{}, false
+		}
+		recv, ok := ch.(*ast.UnaryExpr)
+		if !ok || recv.Op != token.ARROW {
+			return tickerSite{}, false
+		}
+		var created ast.Expr
+		switch x := recv.X.(type) {
+		case *ast.SelectorExpr:
+			if id, ok := x.X.(*ast.Ident); ok && x.Sel.Name == "C" {
+				created = tickers[id.Name]
+			}
+		case *ast.Ident:
+			created = tickers[x.Name+"<-"]
+		case *ast.CallExpr:
+			if timeCall(x, timePkg) == "Tick" {
+				created = x
+			}
+		}
+		if created == nil {
+			return tickerSite{}, false
+		}
+		if site.Line == 0 {
+			site.Line = line(created)
+		}
+	}
+	return site, site.Line != 0
+}
+
+// timeCall returns the name of the time package function e calls, or "".
+func timeCall(e ast.Expr, timePkg string) string {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return ""
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	if id, ok := sel.X.(*ast.Ident); ok && id.Name == timePkg {
+		return sel.Sel.Name
+	}
+	return ""
+}
+
+// importName returns the name file refers to the package path by, or ""
+// when it is not imported.
+func importName(file *ast.File, path string) string {
+	for _, imp := range file.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err != nil || p != path {
+			continue
+		}
+		if imp.Name != nil {
+			if imp.Name.Name == "_" || imp.Name.Name == "." {
+				return ""
+			}
+			return imp.Name.Name
+		}
+		return path[strings.LastIndexByte(path, '/')+1:]
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+// Package traceanalyze indexes the goroutine creations of a runtime
+// execution trace, such as one written by goleaker.WithFlightRecorder or
+// go test -trace, so a leak report can say exactly when and by which
+// goroutine each leaked goroutine was created, without running under
+// GODEBUG=tracebackancestors.
+//
+//	ix, err := traceanalyze.Load("goleaker-123.trace")
+//	...
+//	if c, ok := ix.Goroutine(g.ID); ok {
+//		fmt.Println(c)
+//	}
+package traceanalyze
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rfyiamcool/goleaker"
+)
+
+// Creation is the creation event of a goroutine.
+type Creation struct {
+	// ID is the id of the created goroutine.
+	ID uint64
+	// Parent is the id of the creating goroutine, 0 if unknown.
+	Parent uint64
+	// Time is when the goroutine was created.
+	Time time.Time
+	// Func is the function the goroutine starts in.
+	Func string
+	// Stack is the stack of the go statement, innermost first.
+	Stack []goleaker.Frame
+}
+
+// Site returns the function containing the go statement.
+func (c *Creation) Site() string {
+	if len(c.Stack) == 0 {
+		return ""
+	}
+	return c.Stack[0].Func
+}
+
+func (c *Creation) String() string {
+	s := fmt.Sprintf("goroutine %d running %s created at %s", c.ID, c.Func, c.Time.Format("15:04:05.000000"))
+	if c.Parent != 0 {
+		s += fmt.Sprintf(" by goroutine %d", c.Parent)
+	}
+	if len(c.Stack) > 0 {
+		f := c.Stack[0]
+		s += fmt.Sprintf(" in %s at %s:%d", f.Func, f.File, f.Line)
+	}
+	return s
+}
+
+// Index maps goroutine ids and creation sites to creation events.
+type Index struct {
+	byID   map[uint64]*Creation
+	bySite map[string][]*Creation
+}
+
+// Goroutine returns the creation of the goroutine id, if it was created
+// while the trace was recorded.
+func (ix *Index) Goroutine(id uint64) (*Creation, bool) {
+	c, ok := ix.byID[id]
+	return c, ok
+}
+
+// Site returns the goroutines created by go statements in fn, in order of
+// creation.
+func (ix *Index) Site(fn string) []*Creation {
+	return ix.bySite[fn]
+}
+
+// Load indexes the trace file at path. It runs go tool trace to decode it,
+// so the go command has to be in PATH.
+func Load(path string) (*Index, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "tool", "trace", "-d=parsed", path)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go tool trace: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return Parse(bytes.NewReader(out))
+}
+
+// Parse indexes a trace decoded by go tool trace -d=parsed.
+func Parse(r io.Reader) (*Index, error) {
+	ix := &Index{byID: map[uint64]*Creation{}, bySite: map[string][]*Creation{}}
+	var (
+		// wall and mono map trace clock readings to wall clock times
+		wall  time.Time
+		mono  int64
+		cur   *Creation
+		stack *[]goleaker.Frame
+		start bool
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "M="):
+			cur, stack = nil, nil
+			fields := eventFields(line)
+			if w, ok := fields["Wall"]; ok {
+				t, err := time.Parse(time.RFC3339Nano, w)
+				if err != nil {
+					return nil, fmt.Errorf("traceanalyze: %s", err)
+				}
+				wall, mono = t, atoi(fields["Trace"])
+				continue
+			}
+			if !strings.Contains(line, " StateTransition ") || !strings.Contains(line, " NotExist->") {
+				continue
+			}
+			cur = &Creation{
+				ID:   uint64(atoi(fields["GoID"])),
+				Time: wall.Add(time.Duration(atoi(fields["Time"]) - mono)),
+			}
+			if parent := atoi(fields["G"]); parent > 0 {
+				cur.Parent = uint64(parent)
+			}
+			ix.byID[cur.ID] = cur
+		case cur == nil:
+		case line == "TransitionStack=":
+			stack, start = nil, true
+		case line == "Stack=":
+			stack, start = &cur.Stack, false
+		case strings.HasPrefix(line, "\t\t"):
+			if stack != nil && len(*stack) > 0 {
+				f := &(*stack)[len(*stack)-1]
+				loc := strings.TrimSpace(line)
+				if i := strings.LastIndexByte(loc, ':'); i >= 0 {
+					f.File = loc[:i]
+					f.Line = int(atoi(loc[i+1:]))
+				}
+			}
+		case strings.HasPrefix(line, "\t"):
+			fn := strings.TrimSpace(line)
+			if i := strings.LastIndex(fn, " @ "); i >= 0 {
+				fn = fn[:i]
+			}
+			if start {
+				cur.Func, start = fn, false
+				continue
+			}
+			if stack != nil {
+				*stack = append(*stack, goleaker.Frame{Func: fn})
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, c := range ix.byID {
+		ix.bySite[c.Site()] = append(ix.bySite[c.Site()], c)
+	}
+	for _, cs := range ix.bySite {
+		sort.Slice(cs, func(i, j int) bool { return cs[i].Time.Before(cs[j].Time) })
+	}
+	return ix, nil
+}
+
+// eventFields returns the key=value fields of an event line.
+func eventFields(line string) map[string]string {
+	fields := map[string]string{}
+	for _, f := range strings.Fields(line) {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+func atoi(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
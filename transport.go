@@ -0,0 +1,142 @@
+package goleaker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// transportFuncs are the frame prefixes of the per-connection goroutines
+// of an http.Transport, for both HTTP/1 and HTTP/2.
+var transportFuncs = []string{
+	"net/http.(*persistConn).",
+	"net/http.(*http2ClientConn).",
+	"net/http.(*http2clientConnReadLoop).",
+	"golang.org/x/net/http2.(*ClientConn).",
+	"golang.org/x/net/http2.(*clientConnReadLoop).",
+}
+
+// TransportGracePeriod is how long CheckTransport waits for connection
+// goroutines to exit once the idle connections were closed.
+var TransportGracePeriod = time.Second
+
+// CheckTransport snapshots the currently-running goroutines and returns a
+// function which closes the idle connections of tr and reports any of
+// its connection goroutines that is still running, i.e. a persistConn
+// read or write loop outliving the test because a response body was not
+// closed. Unlike Check it does not ignore these loops. They do not show
+// which transport they belong to, so until the returned function runs tr
+// records the goroutines dialing its connections, which create them: call
+// CheckTransport before tr is used. Connections of other transports and
+// goroutines other than connection goroutines are left to Check.
+func CheckTransport(t ErrorReporter, tr *http.Transport, opts ...Option) func() {
+	d := &transportDials{ids: map[uint64]bool{}}
+	restore := d.track(tr)
+	c := &countingReporter{ErrorReporter: t}
+	opts = append(opts[:len(opts):len(opts)], only(And(funcPrefix(transportFuncs...), d.created)))
+	fn := CheckTimeout(c, scaled(TransportGracePeriod), opts...)
+	if name := testName(t); name != "" {
+		t = namedReporter{ErrorReporter: t, name: name}
+	}
+	return func() {
+		tr.CloseIdleConnections()
+		fn()
+		restore()
+		if c.n > 0 {
+			t.Errorf("leaktest: connections of http.Transport %p are still open: close response bodies", tr)
+		}
+	}
+}
+
+// transportDials are the goroutines which dialed the connections of a
+// transport, and then started their loops.
+type transportDials struct {
+	mu  sync.Mutex
+	ids map[uint64]bool
+}
+
+// track makes tr record the goroutines dialing its connections in d until
+// the returned function restores its dial functions.
+func (d *transportDials) track(tr *http.Transport) func() {
+	dial, dialTLS, dialCtx, dialTLSCtx := tr.Dial, tr.DialTLS, tr.DialContext, tr.DialTLSContext
+	restore := func() {
+		tr.Dial, tr.DialTLS, tr.DialContext, tr.DialTLSContext = dial, dialTLS, dialCtx, dialTLSCtx
+	}
+	if next := dialCtx; next != nil || dial == nil {
+		if next == nil {
+			// the dialer of a transport without dial functions
+			next = (&net.Dialer{}).DialContext
+		}
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d.add()
+			return next(ctx, network, addr)
+		}
+	} else {
+		tr.Dial = func(network, addr string) (net.Conn, error) {
+			d.add()
+			return dial(network, addr)
+		}
+	}
+	if dialTLSCtx != nil {
+		tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d.add()
+			return dialTLSCtx(ctx, network, addr)
+		}
+	} else if dialTLS != nil {
+		tr.DialTLS = func(network, addr string) (net.Conn, error) {
+			d.add()
+			return dialTLS(network, addr)
+		}
+	}
+	return restore
+}
+
+func (d *transportDials) add() {
+	id := CurrentGoroutineID()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ids[id] = true
+}
+
+// created matches the goroutines created by one which dialed for the
+// transport.
+func (d *transportDials) created(g *Goroutine) bool {
+	id, ok := creatorGoroutine(g.Stack)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return ok && d.ids[id]
+}
+
+// only reports nothing but goroutines matched by m, which are always
+// reported.
+func only(m Matcher) Option {
+	return func(o *options) {
+		o.only = append(o.only, m)
+		o.requires = append(o.requires, m)
+	}
+}
+
+// countingReporter counts the errors reported through it.
+type countingReporter struct {
+	ErrorReporter
+	n int
+}
+
+func (c *countingReporter) Errorf(format string, args ...interface{}) {
+	c.n++
+	c.ErrorReporter.Errorf(format, args...)
+}
+
+func (c *countingReporter) Failed() bool {
+	return failed(c.ErrorReporter)
+}
+
+func (c *countingReporter) Name() string {
+	return testName(c.ErrorReporter)
+}
+
+func (c *countingReporter) Logf(format string, args ...interface{}) {
+	logf(c.ErrorReporter, format, args...)
+}
@@ -0,0 +1,55 @@
+package goleaker
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer srv.Close()
+	defer func(d time.Duration) { TransportGracePeriod = d }(TransportGracePeriod)
+	TransportGracePeriod = 200 * time.Millisecond
+	get := func(t *testing.T, tr *http.Transport, closeBody bool) {
+		resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if closeBody {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+	tests := []struct {
+		name       string
+		leak       bool
+		leakOthers bool
+		wantErrs   string
+	}{
+		{"body closed", false, false, ""},
+		{"body left open", true, false, "are still open: close response bodies"},
+		{"other transport left open", false, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, other := &http.Transport{}, &http.Transport{}
+			defer srv.CloseClientConnections()
+			r := &reporter{}
+			check := CheckTransport(r, tr)
+			get(t, tr, !tt.leak)
+			if tt.leakOthers {
+				get(t, other, false)
+			}
+			check()
+			if got := r.errors(); tt.wantErrs == "" && got != "" || !strings.Contains(got, tt.wantErrs) {
+				t.Errorf("CheckTransport reported %q, want %q", got, tt.wantErrs)
+			}
+		})
+	}
+}
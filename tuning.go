@@ -0,0 +1,46 @@
+package goleaker
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// TimeScale multiplies the default grace periods, such as
+// TestMainGracePeriod and DeferGracePeriod, and the default poll interval.
+// Timeouts given explicitly, e.g. to WithTimeout, CheckTimeout or
+// CheckSubprocess, are used as they are. It defaults to 2 on machines
+// with GOMAXPROCS <= 2 or on CI, as told by CI=true, and to 3 on both, so
+// small CI runners do not time out flakily. Set it to 1 to disable the
+// tuning.
+var TimeScale = defaultTimeScale()
+
+// RaceTimeScale further multiplies the default grace periods and poll
+// interval of binaries built with -race, under which goroutines take a
+// lot longer to shut down.
+var RaceTimeScale = 4.0
+
+func defaultTimeScale() float64 {
+	scale := 1.0
+	if runtime.GOMAXPROCS(0) <= 2 {
+		scale++
+	}
+	if ci, _ := strconv.ParseBool(os.Getenv("CI")); ci {
+		scale++
+	}
+	return scale
+}
+
+// scaled returns d multiplied by TimeScale, and by RaceTimeScale under the
+// race detector.
+func scaled(d time.Duration) time.Duration {
+	scale := TimeScale
+	if scale <= 0 {
+		scale = 1
+	}
+	if raceEnabled && RaceTimeScale > 0 {
+		scale *= RaceTimeScale
+	}
+	return time.Duration(float64(d) * scale)
+}
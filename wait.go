@@ -0,0 +1,82 @@
+package goleaker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WaitForExit blocks until none of the goroutines matching m is running,
+// the calling one aside, or ctx is done, in which case it returns an
+// error wrapping the error of ctx. It captures every goroutine of the
+// process on each poll, starting at the poll interval of checks and
+// backing off to a second, so shutdown paths can wait for e.g. request
+// handlers to drain:
+//
+//	goleaker.WaitForExit(ctx, goleaker.AnyFrame("example.com/api.(*Server).handle"))
+func WaitForExit(ctx context.Context, m Matcher) error {
+	left, err := waitForExit(ctx, m)
+	if err == nil && len(left) > 0 {
+		err = fmt.Errorf("goleaker: %d goroutine(s) still running: %w", len(left), context.Cause(ctx))
+	}
+	return err
+}
+
+// DrainAndVerify calls stop, e.g. the Shutdown of a server, and waits for
+// the goroutines matching m to exit as WaitForExit does. When ctx is done
+// first, it returns a *LeakError listing the stragglers, which
+// errors.Is also matches against the error of ctx.
+func DrainAndVerify(ctx context.Context, stop func(), m Matcher) error {
+	stop()
+	left, err := waitForExit(ctx, m)
+	if err != nil || len(left) == 0 {
+		return err
+	}
+	cause := context.Cause(ctx)
+	var b strings.Builder
+	fmt.Fprintf(&b, "leaktest: %d goroutine(s) still running after stop, %v:\n%s",
+		len(left), cause, formatGroups(groupGoroutines(left)))
+	reports := []string{b.String()}
+	for _, g := range left {
+		reports = append(reports, fmt.Sprintf("leaktest: straggling goroutine (sig %s, %s): %s", g.SignatureID(), g.Class(), g.Stack))
+	}
+	return &LeakError{leaks: newLeaks(newOptions(nil), left), reports: reports, cause: cause}
+}
+
+// waitForExit returns the goroutines matching m still running once ctx
+// is done, or none once they all exited. Only a capture finding none of
+// them counts as exited, even when ctx is done from the start.
+func waitForExit(ctx context.Context, m Matcher) ([]*Goroutine, error) {
+	self := CurrentGoroutineID()
+	capture := func() ([]*Goroutine, error) {
+		gs, err := RuntimeSource().Capture()
+		if err != nil {
+			return nil, err
+		}
+		var left []*Goroutine
+		for i := range gs {
+			if g := &gs[i]; g.ID != self && m(g) {
+				left = append(left, g)
+			}
+		}
+		return left, nil
+	}
+	interval := tickerInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		left, err := capture()
+		if err != nil || len(left) == 0 {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			// the goroutines may have exited while stop blocked
+			return capture()
+		case <-timer.C:
+		}
+		timer.Reset(interval)
+		interval = min(2*interval, time.Second)
+	}
+}
@@ -0,0 +1,57 @@
+package goleaker
+
+import "log/slog"
+
+// Warn makes the leaks matched by any of ms warnings, which are logged
+// instead of failing the check, so a policy can be tightened gradually.
+func Warn(ms ...Matcher) Option {
+	return func(o *options) {
+		o.warns = append(o.warns, ms...)
+	}
+}
+
+// WithFailAbove only fails the check when more than n goroutines leaked;
+// up to n leaks are warnings.
+func WithFailAbove(n int) Option {
+	return func(o *options) {
+		o.failAbove = n
+	}
+}
+
+// WithWarnLogger logs warnings to l instead of through the Logf method of
+// the ErrorReporter.
+func WithWarnLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.warnLogger = l
+	}
+}
+
+// downgrade logs the leaks that only warrant a warning and returns the
+// ones failing the check.
+func (o *options) downgrade(t ErrorReporter, leaked []*Goroutine) []*Goroutine {
+	o.flaky = o.recordFlakes(t, leaked)
+	quarantined := o.quarantined(t, leaked)
+	var failing, warned []*Goroutine
+	for _, g := range leaked {
+		if quarantined[g.ID] || o.flakeQuarantine && o.flaky[g.ID] || Or(o.warns...)(g) {
+			warned = append(warned, g)
+		} else {
+			failing = append(failing, g)
+		}
+	}
+	if len(failing) <= o.failAbove {
+		warned, failing = append(warned, failing...), nil
+	}
+	for _, g := range warned {
+		o.warn(t, g)
+	}
+	return failing
+}
+
+func (o *options) warn(t ErrorReporter, g *Goroutine) {
+	if o.warnLogger != nil {
+		o.warnLogger.Warn("leaked goroutine", "sig", g.SignatureID(), "state", g.State, "test", o.testName, "stack", g.Stack)
+		return
+	}
+	logf(t, "leaktest: warning: leaked goroutine (%s): %v", o.leakInfo(g), g.Stack)
+}
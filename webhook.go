@@ -0,0 +1,319 @@
+package goleaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// WebhookData is the data a WebhookSink renders its payload from.
+type WebhookData struct {
+	Time       time.Time      `json:"time"`
+	Goroutines int            `json:"goroutines"`
+	Leaked     int            `json:"leaked"`
+	Summary    string         `json:"summary"`
+	Groups     []WebhookGroup `json:"groups"`
+	Metrics    RuntimeMetrics `json:"metrics"`
+	// Test is the test of a check in dry run mode, see WithDryRun.
+	Test string `json:"test,omitempty"`
+	// Resolved are the incidents of WithAlertDedup resolved since the
+	// last report.
+	Resolved []Incident `json:"resolved,omitempty"`
+	// Findings are the leaks other than of goroutines of a check in dry
+	// run mode.
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// WebhookGroup is a set of leaked goroutines sharing a signature.
+type WebhookGroup struct {
+	Signature string `json:"signature"`
+	// ID is the SignatureID of the group.
+	ID    string `json:"id"`
+	Count int    `json:"count"`
+	State string `json:"state"`
+	// Class is the LeakClass of the group.
+	Class     LeakClass `json:"class"`
+	Top       string    `json:"top"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	// Fingerprint is the fingerprint of the incident of the group, with
+	// WithAlertDedup.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Delta is how Count changed since the last post of the sink, Count
+	// for signatures it did not post before.
+	Delta int `json:"delta"`
+	// Stack is the stack of one goroutine of the group.
+	Stack string `json:"stack"`
+}
+
+// webhookTop is the number of groups the Slack blocks and Teams card
+// templates list.
+const webhookTop = 10
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// headline is the first line of an alert.
+	"headline": func(d WebhookData) string {
+		switch {
+		case d.Leaked == 0 && len(d.Findings) > 0:
+			return fmt.Sprintf("goleaker: %d leak(s) found", len(d.Findings))
+		case d.Leaked == 0 && len(d.Resolved) > 0:
+			return fmt.Sprintf("goleaker: %d incident(s) resolved", len(d.Resolved))
+		}
+		return fmt.Sprintf("goleaker: %d goroutine(s) leaked", d.Leaked)
+	},
+	// resolved renders a resolved incident.
+	"resolved": func(inc Incident) string {
+		return fmt.Sprintf("resolved incident %s, sig %s, open for %s", inc.Fingerprint, inc.ID, inc.Resolved.Sub(inc.Opened).Round(time.Second))
+	},
+	// top returns the largest groups, which come first.
+	"top": func(groups []WebhookGroup) []WebhookGroup {
+		return groups[:min(len(groups), webhookTop)]
+	},
+	// more returns how many groups top left out.
+	"more": func(groups []WebhookGroup) int {
+		return max(len(groups)-webhookTop, 0)
+	},
+	// trend renders the delta of a group as an arrow, e.g. "↑+3".
+	"trend": func(g WebhookGroup) string {
+		switch {
+		case g.Delta > 0:
+			return fmt.Sprintf("↑%+d", g.Delta)
+		case g.Delta < 0:
+			return fmt.Sprintf("↓%+d", g.Delta)
+		}
+		return "→"
+	},
+}
+
+// SlackTemplate renders a Slack incoming webhook message.
+var SlackTemplate = template.Must(template.New("slack").Funcs(webhookFuncs).Parse(
+	`{"text": {{json .Summary}}}`))
+
+// PagerDutyTemplate renders a PagerDuty Events API v2 trigger event for
+// the integration with the given routing key. Send it to
+// https://events.pagerduty.com/v2/enqueue.
+func PagerDutyTemplate(routingKey string) *template.Template {
+	return template.Must(template.New("pagerduty").Funcs(webhookFuncs).Parse(
+		`{"routing_key": ` + mustJSON(routingKey) + `, "event_action": "trigger", ` +
+			`"payload": {"summary": {{json .Summary}}, "source": "goleaker", "severity": "warning", ` +
+			`"custom_details": {{json .}}}}`))
+}
+
+// SlackBlocksTemplate renders a Slack incoming webhook message with a
+// header, the ten largest signatures, their counts and trends, the
+// incidents resolved and the findings of dry run checks, as Block Kit
+// sections.
+var SlackBlocksTemplate = template.Must(template.New("slack-blocks").Funcs(webhookFuncs).Parse(
+	`{"text": {{json (headline .)}}, "blocks": [` +
+		`{"type": "header", "text": {"type": "plain_text", "text": {{json (headline .)}}}}` +
+		`{{range top .Groups}}, {"type": "section", "text": {"type": "mrkdwn", ` +
+		`"text": {{json (printf "*%d* %s  ` + "`%s`" + `\n%s, %s, sig %s" .Count (trend .) .Top .Class .State .ID)}}}}{{end}}` +
+		`{{with more .Groups}}, {"type": "context", "elements": [{"type": "mrkdwn", "text": {{json (printf "and %d more signature(s)" .)}}}]}{{end}}` +
+		`{{range .Resolved}}, {"type": "section", "text": {"type": "mrkdwn", "text": {{json (resolved .)}}}}{{end}}` +
+		`{{range .Findings}}, {"type": "section", "text": {"type": "mrkdwn", "text": {{json .Message}}}}{{end}}` +
+		`, {"type": "context", "elements": [{"type": "mrkdwn", "text": {{json (printf "%d goroutine(s), runtime: %s" .Goroutines .Metrics)}}}]}]}`))
+
+// TeamsTemplate renders a Microsoft Teams message with an adaptive card
+// listing the ten largest signatures, their counts and trends, the
+// incidents resolved and the findings of dry run checks, for Teams
+// workflows and incoming webhooks.
+var TeamsTemplate = template.Must(template.New("teams").Funcs(webhookFuncs).Parse(
+	`{"type": "message", "attachments": [{"contentType": "application/vnd.microsoft.card.adaptive", "content": {` +
+		`"$schema": "http://adaptivecards.io/schemas/adaptive-card.json", "type": "AdaptiveCard", "version": "1.4", "body": [` +
+		`{"type": "TextBlock", "size": "Medium", "weight": "Bolder", "wrap": true, ` +
+		`"text": {{json (headline .)}}}, ` +
+		`{"type": "FactSet", "facts": [{{range $i, $g := top .Groups}}{{if $i}}, {{end}}` +
+		`{"title": {{json (printf "%d %s" .Count (trend .))}}, "value": {{json (printf "%s (%s, sig %s)" .Top .Class .ID)}}}{{end}}]}` +
+		`{{with more .Groups}}, {"type": "TextBlock", "wrap": true, "text": {{json (printf "and %d more signature(s)" .)}}}{{end}}` +
+		`{{range .Resolved}}, {"type": "TextBlock", "wrap": true, "text": {{json (resolved .)}}}{{end}}` +
+		`{{range .Findings}}, {"type": "TextBlock", "wrap": true, "text": {{json .Message}}}{{end}}` +
+		`, {"type": "TextBlock", "isSubtle": true, "wrap": true, "text": {{json (printf "%d goroutine(s), runtime: %s" .Goroutines .Metrics)}}}]}}]}`))
+
+// webhookTimeout bounds the posts of a WebhookSink without a Client.
+const webhookTimeout = 10 * time.Second
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+func mustJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// WebhookSink POSTs Monitor reports to a webhook. Each signature is only
+// sent once, and reports arriving within MinInterval of the last post are
+// held back and posted, merged, once it elapsed. With
+// WithAlertDedup the Monitor decides instead: every incident it alerts on
+// or resolves is sent.
+type WebhookSink struct {
+	// URL receives the POST requests.
+	URL string
+	// Template renders the request body from a WebhookData. The default
+	// sends the WebhookData itself as JSON.
+	Template *template.Template
+	// MinInterval is the minimum time between two posts.
+	MinInterval time.Duration
+	// Client sends the requests. If nil, a client giving up after
+	// webhookTimeout is used, so a hung endpoint cannot stall the Monitor.
+	Client *http.Client
+
+	mu   sync.Mutex
+	last time.Time
+	// pending merges the reports held back within MinInterval.
+	pending *MonitorReport
+	sent    map[string]bool
+	// counts are the counts of the signatures in the last post.
+	counts map[string]int
+}
+
+// Report implements Sink.
+func (s *WebhookSink) Report(r MonitorReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	held := s.pending != nil
+	if held {
+		r = mergeReports(*s.pending, r)
+		s.pending = nil
+	}
+	if wait := s.MinInterval - time.Since(s.last); s.MinInterval > 0 && wait > 0 {
+		s.pending = &r
+		if !held {
+			time.AfterFunc(wait, s.flush)
+		}
+		return
+	}
+	s.send(r)
+}
+
+// flush posts the pending reports once MinInterval elapsed. A timer armed
+// before a later post finds it did not, and leaves them to the timer
+// armed since.
+func (s *WebhookSink) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil || time.Since(s.last) < s.MinInterval {
+		return
+	}
+	r := *s.pending
+	s.pending = nil
+	s.send(r)
+}
+
+// send posts r if it has signatures or incidents not posted before.
+// s.mu must be held.
+func (s *WebhookSink) send(r MonitorReport) {
+	groups := groupGoroutines(r.Leaked)
+	fresh := len(r.Incidents)+len(r.Resolved)+len(r.Findings) > 0
+	for _, gr := range groups {
+		fresh = fresh || !s.sent[gr.sig]
+	}
+	if !fresh {
+		return
+	}
+	data := webhookData(r, groups)
+	for i := range data.Groups {
+		data.Groups[i].Delta = data.Groups[i].Count - s.counts[data.Groups[i].Signature]
+	}
+	if err := s.post(data); err != nil {
+		log.Printf("goleaker: webhook: %s", err)
+		return
+	}
+	s.last = time.Now()
+	if s.sent == nil {
+		s.sent = map[string]bool{}
+	}
+	s.counts = map[string]int{}
+	for _, gr := range groups {
+		s.sent[gr.sig] = true
+		s.counts[gr.sig] = len(gr.goroutines)
+	}
+}
+
+// mergeReports merges the held back report p into the later report r,
+// whose goroutines supersede those of p with the same signature.
+func mergeReports(p, r MonitorReport) MonitorReport {
+	sigs := map[string]bool{}
+	for _, g := range r.Leaked {
+		sigs[signature(g.Stack)] = true
+	}
+	leaked := append([]*Goroutine(nil), r.Leaked...)
+	for _, g := range p.Leaked {
+		if !sigs[signature(g.Stack)] {
+			leaked = append(leaked, g)
+		}
+	}
+	r.Leaked = leaked
+	if p.Test != r.Test {
+		r.Test, r.Cause = "", ""
+	}
+	r.Incidents = append(append([]Incident(nil), p.Incidents...), r.Incidents...)
+	r.Resolved = append(append([]Incident(nil), p.Resolved...), r.Resolved...)
+	r.Findings = append(append([]Finding(nil), p.Findings...), r.Findings...)
+	return r
+}
+
+func (s *WebhookSink) post(data WebhookData) error {
+	var body bytes.Buffer
+	if s.Template != nil {
+		if err := s.Template.Execute(&body, data); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&body).Encode(data); err != nil {
+		return err
+	}
+	client := s.Client
+	if client == nil {
+		client = webhookClient
+	}
+	resp, err := client.Post(s.URL, "application/json", &body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+func webhookData(r MonitorReport, groups []*group) WebhookData {
+	data := WebhookData{
+		Time:       r.Time,
+		Test:       r.Test,
+		Goroutines: r.Goroutines,
+		Leaked:     len(r.Leaked),
+		Summary:    monitorSummary(r, groups),
+		Metrics:    r.Metrics,
+		Resolved:   r.Resolved,
+		Findings:   r.Findings,
+	}
+	fingerprints := map[string]string{}
+	for _, inc := range r.Incidents {
+		fingerprints[inc.ID] = inc.Fingerprint
+	}
+	for _, gr := range groups {
+		g := gr.goroutines[0]
+		data.Groups = append(data.Groups, WebhookGroup{
+			Signature:   gr.sig,
+			ID:          gr.id,
+			Count:       len(gr.goroutines),
+			State:       gr.state,
+			Class:       gr.class,
+			Top:         gr.top,
+			CreatedBy:   g.CreatedBy,
+			Fingerprint: fingerprints[gr.id],
+			Stack:       g.Stack,
+		})
+	}
+	return data
+}
@@ -0,0 +1,210 @@
+package goleaker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML decodes the small subset of YAML needed for config files:
+// block mappings and sequences, flow sequences of scalars, quoted and
+// plain scalars and comments. The result only holds JSON types, so it can
+// be marshaled to JSON and decoded into a struct. Plain scalars other
+// than null stay strings, such as the ticket 4711 or the signature 12e4,
+// and fields of other types convert them.
+func parseYAML(data []byte) (interface{}, error) {
+	var lines []yamlLine
+	for n, raw := range strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", n+1)
+		}
+		lines = append(lines, yamlLine{n: n + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", p.lines[p.i].n)
+	}
+	return v, nil
+}
+
+type yamlLine struct {
+	n      int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if l := p.lines[p.i]; l.text == "-" || strings.HasPrefix(l.text, "- ") {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent != indent || (l.text != "-" && !strings.HasPrefix(l.text, "- ")) {
+			break
+		}
+		item := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		switch {
+		case item == "":
+			p.i++
+			v, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		case isYAMLKey(item):
+			// "- key: value" starts a mapping indented past the dash
+			p.lines[p.i] = yamlLine{n: l.n, indent: l.indent + len(l.text) - len(item), text: item}
+			v, err := p.mapping(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		default:
+			p.i++
+			v, err := yamlScalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("yaml: line %d: %s", l.n, err)
+			}
+			seq = append(seq, v)
+		}
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent || !isYAMLKey(l.text) {
+			return nil, fmt.Errorf("yaml: line %d: expected a key at indentation %d", l.n, indent)
+		}
+		key, rest := splitYAMLKey(l.text)
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("yaml: line %d: duplicate key %q", l.n, key)
+		}
+		p.i++
+		if rest != "" {
+			v, err := yamlScalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("yaml: line %d: %s", l.n, err)
+			}
+			m[key] = v
+			continue
+		}
+		// a sequence may sit at the same indentation as its key
+		if p.i < len(p.lines) && p.lines[p.i].indent == indent && strings.HasPrefix(p.lines[p.i].text, "-") {
+			v, err := p.sequence(indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		v, err := p.nested(indent)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// nested parses the block indented past indent, or returns nil if there
+// is none.
+func (p *yamlParser) nested(indent int) (interface{}, error) {
+	if p.i >= len(p.lines) || p.lines[p.i].indent <= indent {
+		return nil, nil
+	}
+	return p.block(p.lines[p.i].indent)
+}
+
+func isYAMLKey(text string) bool {
+	if text[0] == '"' || text[0] == '\'' || text[0] == '[' {
+		return false
+	}
+	i := strings.Index(text, ":")
+	return i > 0 && (i == len(text)-1 || text[i+1] == ' ')
+}
+
+func splitYAMLKey(text string) (string, string) {
+	i := strings.Index(text, ":")
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+}
+
+func yamlScalar(s string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence %q", s)
+		}
+		seq := []interface{}{}
+		inner := strings.TrimSpace(s[1 : len(s)-1])
+		if inner == "" {
+			return seq, nil
+		}
+		for _, item := range strings.Split(inner, ",") {
+			v, err := yamlScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("unterminated string %q", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+	if s == "~" || s == "null" {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// stripYAMLComment removes a trailing comment outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if quote == '"' && c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[,", line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
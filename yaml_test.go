@@ -0,0 +1,119 @@
+package goleaker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want interface{}
+	}{
+		{"empty", "# nothing\n---\n", nil},
+		{"mapping", "a: 1\nb: x y\n", map[string]interface{}{"a": "1", "b": "x y"}},
+		{"plain scalars stay strings", "n: 4711\nf: 12e4\nb: true\nd: 2024-06-30\n",
+			map[string]interface{}{"n": "4711", "f": "12e4", "b": "true", "d": "2024-06-30"}},
+		{"null", "a: ~\nb: null\nc:\n", map[string]interface{}{"a": nil, "b": nil, "c": nil}},
+		{"quoted", `a: "x # y"` + "\n" + `b: 'it''s'` + "\n" + `c: "\t"`,
+			map[string]interface{}{"a": "x # y", "b": "it's", "c": "\t"}},
+		{"comments", "# head\na: x # trailing\nb: x#y\n", map[string]interface{}{"a": "x", "b": "x#y"}},
+		{"flow sequence", "a: [1, 'b', c]\nb: []\n",
+			map[string]interface{}{"a": []interface{}{"1", "b", "c"}, "b": []interface{}{}}},
+		{"block sequence", "a:\n  - x\n  - 2\nb:\n- y\n",
+			map[string]interface{}{"a": []interface{}{"x", "2"}, "b": []interface{}{"y"}}},
+		{"sequence of mappings", "ignore:\n  - package: a/...\n    max: 1\n  - top_func: time.Sleep\n",
+			map[string]interface{}{"ignore": []interface{}{
+				map[string]interface{}{"package": "a/...", "max": "1"},
+				map[string]interface{}{"top_func": "time.Sleep"},
+			}}},
+		{"nested mapping", "a:\n  b:\n    c: d\n", map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": "d"}}}},
+		{"crlf", "a: x\r\nb: y\r\n", map[string]interface{}{"a": "x", "b": "y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"tab indentation", "a:\n\t- x\n", "line 2: tabs"},
+		{"duplicate key", "a: x\na: y\n", `line 2: duplicate key "a"`},
+		{"unexpected indentation", "a: x\n  b: y\n", "line 2: expected a key"},
+		{"unterminated flow sequence", "a: [x, y\n", "unterminated flow sequence"},
+		{"unterminated string", "a: 'x\n", "unterminated string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseYAML error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConfigYAMLScalars(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+ignore:
+  - signature: 12e4
+    ticket: 4711
+    owner: jane
+    expires: 2099-06-30
+  - signature: "0042"
+budget:
+  - any_frame: example.com/cache.(*Cache).janitor
+    max: 2
+strict: true
+`), false)
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	want := []Rule{
+		{Signature: "12e4", Ticket: "4711", Owner: "jane", Expires: "2099-06-30"},
+		{Signature: "0042"},
+	}
+	if !reflect.DeepEqual(c.Ignore, want) {
+		t.Errorf("Ignore = %+v, want %+v", c.Ignore, want)
+	}
+	if len(c.Budget) != 1 || c.Budget[0].Max != 2 || c.Budget[0].AnyFrame != "example.com/cache.(*Cache).janitor" {
+		t.Errorf("Budget = %+v, want max 2 for the janitor", c.Budget)
+	}
+	if !c.Strict {
+		t.Errorf("Strict = false, want true")
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+		isJSON         bool
+	}{
+		{"unknown field", "ignore:\n  - top_fun: x\n", "unknown field", false},
+		{"unknown budget field", "budget:\n  - max: 1\n    maks: 2\n", "unknown field", false},
+		{"max not a number", "budget:\n  - max: lots\n", "not an integer", false},
+		{"json max not an integer", `{"budget": [{"top_func": "x", "max": 1.5}]}`, "not an integer", true},
+		{"strict not a boolean", "strict: sure\n", "not a boolean", false},
+		{"unknown top-level field", "strikt: true\n", "unknown field", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.in), tt.isJSON)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseConfig error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}